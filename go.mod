@@ -5,7 +5,10 @@ go 1.13
 require (
 	github.com/DATA-DOG/go-sqlmock v1.4.1
 	github.com/jmoiron/sqlx v1.2.0
+	github.com/klauspost/compress v1.11.0
 	github.com/lib/pq v1.3.0
 	github.com/stretchr/testify v1.5.1
 	golang.org/x/crypto v0.0.0-20200323165209-0ec3e9974c59 // indirect
+	golang.org/x/text v0.3.3
+	gopkg.in/yaml.v2 v2.2.2
 )
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"data_play/pkg/config"
+	"data_play/pkg/database"
+	"data_play/pkg/worker"
+	"flag"
+	"fmt"
+)
+
+func runLoad(args []string) int {
+	o := &options{}
+	fs := flag.NewFlagSet("load", flag.ExitOnError)
+	o.connectionFlags(fs)
+	o.inputFlags(fs)
+	o.loadFlags(fs)
+	o.configFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		fmt.Println(err)
+		return 2
+	}
+
+	cfg, jobs, err := o.jobs()
+	if err != nil {
+		fmt.Println(err)
+		return 2
+	}
+	cancelContext, cancel := interruptContext()
+	defer cancel()
+	dbs := make(map[string]*database.PostgresDB)
+	code := 0
+	for _, job := range jobs {
+		if cancelContext.Err() != nil {
+			return 1
+		}
+		db, ok := dbs[job.Database]
+		if !ok {
+			db, err = connect(cfg.Databases[job.Database])
+			if err != nil {
+				fmt.Println(err)
+				return 1
+			}
+			dbs[job.Database] = db
+		}
+		sqlWorker, err := newWorker(job, db)
+		if err != nil {
+			fmt.Printf("Job %s: %v\n", job.Name, err)
+			code = 1
+			continue
+		}
+		inputs, err := listInputs(job.Input)
+		if err != nil {
+			fmt.Printf("Job %s: %v\n", job.Name, err)
+			code = 1
+			continue
+		}
+		failed := runJobs(cancelContext, job.Workers, inputs, sqlWorker.Run)
+		if cancelContext.Err() != nil || failed > 0 {
+			fmt.Printf("Job %s done, %d of %d files failed\n", job.Name, failed, len(inputs))
+			code = 1
+			continue
+		}
+		fmt.Printf("Job %s done\n", job.Name)
+	}
+	return code
+}
+
+// newWorker builds the worker of a job and prepares its ledger
+func newWorker(job *config.Job, db *database.PostgresDB) (*worker.SQLWorker, error) {
+	sqlWorker, err := worker.NewSQLWorker(job, db.Conn())
+	if err != nil {
+		return nil, err
+	}
+	if sqlWorker.Ledger != nil {
+		err = sqlWorker.Ledger.Init(db.Conn())
+		if err != nil {
+			return nil, fmt.Errorf("Fail to create ledger %v", err)
+		}
+	}
+	return sqlWorker, nil
+}
@@ -1,89 +1,42 @@
 package main
 
 import (
-	"context"
-	"data_play/pkg/database"
-	"data_play/pkg/parser"
-	"data_play/pkg/worker"
 	"fmt"
-	"io/ioutil"
 	"os"
-	"os/signal"
-	"path/filepath"
-	"runtime"
-	"sync"
 )
 
-func main() {
-	var err error
-	var wg sync.WaitGroup
-	jobChan := make(chan string)
-	osChan := make(chan os.Signal)
-	closeChan := make(chan int)
-	cancelContext, cancel := context.WithCancel(context.Background())
-
-	db := &database.PostgresDB{
-		Host:     "localhost",
-		Port:     "5433",
-		Database: "dataplay",
-		Username: "postgres",
-		Password: "example",
-		Query:    "sslmode=disable",
-	}
-	err = db.Init()
-	if err != nil {
-		fmt.Printf("Fail to connecto db %v\n", err)
-		os.Exit(1)
-	}
-
-	// hardcode current Dir
-	currentDir, _ := os.Getwd()
-	queryer := &database.QueryerImpl{}
-	parserFactory := parser.NewDataParserFactory(currentDir + "/specs/")
-	sqlWorker := &worker.SQLWorker{
-		DB:            db.Conn(),
-		ParserFactory: parserFactory,
-		Queryer:       queryer,
-		BufferSize:    50,
-	}
-	var files []os.FileInfo
-	files, err = ioutil.ReadDir(currentDir + "/data")
-	if err != nil {
-		fmt.Println("fail to read data file")
-		os.Exit(1)
-	}
+const usage = `Usage: data_play <command> [flags]
 
-	signal.Notify(osChan, os.Interrupt)
+Commands:
+  load      load the data files into postgres
+  watch     keep loading the data files dropped in the inputs
+  validate  parse the data files against their spec without a database
+  schema    print (or apply with -apply) the tables of the specs
 
-	go func() {
-		select {
-		case <-osChan:
-			fmt.Println("OS interrupted exit")
-			cancel()
-			break
-		case <-closeChan:
-		}
-	}()
+Flags can also be set by env, -batch-size is DATAPLAY_BATCH_SIZE.
+Run data_play <command> -h for the flags of a command.
+`
 
-	for i := 0; i < runtime.GOMAXPROCS(0); i++ {
-		go sqlWorker.Start(jobChan, &wg, cancelContext)
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Print(usage)
+		os.Exit(2)
 	}
-
-jobloop:
-	for _, file := range files {
-		if filepath.Ext(file.Name()) != ".txt" {
-			continue
-		}
-		select {
-		case <-cancelContext.Done():
-			break jobloop
-		case jobChan <- currentDir + "/data/" + file.Name():
-			break
-		}
+	var code int
+	switch os.Args[1] {
+	case "load":
+		code = runLoad(os.Args[2:])
+	case "watch":
+		code = runWatch(os.Args[2:])
+	case "validate":
+		code = runValidate(os.Args[2:])
+	case "schema":
+		code = runSchema(os.Args[2:])
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Printf("Unknown command %s\n\n%s", os.Args[1], usage)
+		code = 2
 	}
-
-	close(jobChan)
-	wg.Wait()
-	fmt.Println("Done")
-	close(closeChan)
+	os.Exit(code)
 }
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"data_play/pkg/config"
+	"data_play/pkg/database"
+	"data_play/pkg/parser"
+	"data_play/pkg/worker"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const envPrefix = "DATAPLAY_"
+
+const defaultDSN = "host=localhost port=5433 dbname=dataplay user=postgres password=example sslmode=disable"
+
+type options struct {
+	dsn              string
+	maxConns         int
+	specDir          string
+	dataDir          string
+	ext              string
+	encoding         string
+	maxRecordLength  int
+	workers          int
+	parseWorkers     int
+	batchSize        int
+	insertMethod     string
+	loadMode         string
+	rejects          bool
+	maxRejects       int
+	maxRejectPercent float64
+	ledger           bool
+	force            bool
+	allowDestructive bool
+	lineage          bool
+	configPath       string
+	jobNames         string
+}
+
+func (o *options) connectionFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.dsn, "dsn", defaultDSN, "postgres connection string")
+	fs.IntVar(&o.maxConns, "max-conns", database.DefaultMaxOpenConns, "max open connections, also the insert writers of every file")
+}
+
+func (o *options) inputFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.specDir, "specs", "specs", "directory of the spec csv")
+	fs.StringVar(&o.dataDir, "data", "data", "directory of the data files")
+	fs.StringVar(&o.ext, "ext", ".txt", "extension of the data files")
+	fs.StringVar(&o.encoding, "encoding", "", "encoding of the data files, like shift_jis or ebcdic, default is the spec encoding")
+	fs.IntVar(&o.maxRecordLength, "max-record-length", 0, "longest line of the data files in bytes, default is the spec max or 1MB")
+}
+
+func (o *options) loadFlags(fs *flag.FlagSet) {
+	fs.IntVar(&o.workers, "workers", runtime.GOMAXPROCS(0), "files loaded at the same time")
+	fs.IntVar(&o.parseWorkers, "parse-workers", 1, "ranges of one large file parsed at the same time")
+	fs.IntVar(&o.batchSize, "batch-size", 5000, "rows per insert, -insert insert splits a batch into statements of at most 65535 values")
+	fs.StringVar(&o.insertMethod, "insert", "copy", "insert method, copy or insert")
+	fs.StringVar(&o.loadMode, "mode", worker.LoadAppend, "load mode, append, merge or swap")
+	fs.BoolVar(&o.rejects, "rejects", false, "write bad rows to <file>.rejects instead of stopping")
+	fs.IntVar(&o.maxRejects, "max-rejects", 0, "fail a file over this many rejects, 0 is no limit")
+	fs.Float64Var(&o.maxRejectPercent, "max-reject-percent", 0, "fail a file over this percent of rejects, 0 is no limit, needs -mode merge or swap")
+	fs.BoolVar(&o.ledger, "ledger", true, "skip files already loaded according to the ledger")
+	fs.BoolVar(&o.force, "force", false, "load files again even if the ledger has them")
+	fs.BoolVar(&o.allowDestructive, "allow-destructive", false, "let a spec change narrow, retype or drop columns")
+	fs.BoolVar(&o.lineage, "lineage", false, "add source_file, source_line and loaded_at to every row")
+}
+
+func (o *options) configFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.configPath, "config", "", "yaml or json config of databases and jobs, replaces the flags above")
+	fs.StringVar(&o.jobNames, "job", "", "comma separated jobs of -config to run, default all")
+}
+
+// parseFlags reads DATAPLAY_<FLAG> env first so the command line wins
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		name := envPrefix + strings.ToUpper(strings.Replace(f.Name, "-", "_", -1))
+		value, ok := os.LookupEnv(name)
+		if !ok || err != nil {
+			return
+		}
+		if setErr := fs.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("invalid %s: %v", name, setErr)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return fs.Parse(args)
+}
+
+// jobs returns the jobs of -config, or a single job named default made of
+// the flags when there is no config
+func (o *options) jobs() (*config.Config, []*config.Job, error) {
+	if o.configPath != "" {
+		cfg, err := config.Load(o.configPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		var names []string
+		if o.jobNames != "" {
+			names = strings.Split(o.jobNames, ",")
+		}
+		jobs, err := cfg.Select(names...)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, job := range jobs {
+			job.Force = job.Force || o.force
+		}
+		return cfg, jobs, nil
+	}
+
+	ledger := o.ledger
+	job := &config.Job{
+		Name:             "default",
+		Database:         "default",
+		Input:            filepath.Join(o.dataDir, "*"+o.ext),
+		SpecDir:          o.specDir,
+		Encoding:         o.encoding,
+		MaxRecordLength:  o.maxRecordLength,
+		BatchSize:        o.batchSize,
+		Workers:          o.workers,
+		ParseWorkers:     o.parseWorkers,
+		Insert:           o.insertMethod,
+		LoadMode:         o.loadMode,
+		Ledger:           &ledger,
+		Force:            o.force,
+		AllowDestructive: o.allowDestructive,
+		Lineage:          o.lineage,
+	}
+	if o.rejects {
+		job.Rejects = &config.Rejects{
+			MaxCount:   o.maxRejects,
+			MaxPercent: o.maxRejectPercent,
+		}
+	}
+	cfg := &config.Config{
+		Databases: map[string]*config.Database{"default": o.database()},
+		Jobs:      []*config.Job{job},
+	}
+	return cfg, cfg.Jobs, nil
+}
+
+// database is the database of the connection flags
+func (o *options) database() *config.Database {
+	return &config.Database{DSN: o.dsn, MaxOpenConns: o.maxConns}
+}
+
+func connect(target *config.Database) (*database.PostgresDB, error) {
+	db := &database.PostgresDB{DSN: target.DSN, MaxOpenConns: target.MaxOpenConns}
+	err := db.Init()
+	if err != nil {
+		return nil, fmt.Errorf("Fail to connect db %v", err)
+	}
+	return db, nil
+}
+
+// listInputs returns the files matching the glob of a job, with their
+// compressed files and the members of the zip archives next to them
+func listInputs(pattern string) ([]string, error) {
+	var inputs []string
+	listed := make(map[string]bool)
+	for _, glob := range parser.InputGlobs(pattern) {
+		matches, err := filepath.Glob(glob)
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil || info.IsDir() || listed[match] {
+				continue
+			}
+			listed[match] = true
+			if !parser.IsArchive(match) {
+				inputs = append(inputs, match)
+				continue
+			}
+			members, err := parser.ArchiveMembers(match, filepath.Base(pattern))
+			if err != nil {
+				return nil, err
+			}
+			inputs = append(inputs, members...)
+		}
+	}
+	return inputs, nil
+}
+
+// specPath is the spec directory as the parser factory expects it
+func specPath(specDir string) string {
+	return filepath.Clean(specDir) + string(filepath.Separator)
+}
+
+// interruptContext is canceled on the first interrupt
+func interruptContext() (context.Context, func()) {
+	cancelContext, cancel := context.WithCancel(context.Background())
+	osChan := make(chan os.Signal, 1)
+	signal.Notify(osChan, os.Interrupt)
+	go func() {
+		select {
+		case <-osChan:
+			fmt.Println("OS interrupted exit")
+			cancel()
+		case <-cancelContext.Done():
+		}
+	}()
+	return cancelContext, func() {
+		signal.Stop(osChan)
+		cancel()
+	}
+}
+
+// runJobs calls run on every job with a pool of workers and returns how
+// many failed
+func runJobs(cancelContext context.Context, workers int, jobs []string, run func(context.Context, string) error) int {
+	var wg sync.WaitGroup
+	var failed int32
+	jobChan := make(chan string)
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobChan {
+				if err := run(cancelContext, job); err != nil {
+					fmt.Println(err)
+					atomic.AddInt32(&failed, 1)
+				}
+			}
+		}()
+	}
+
+jobloop:
+	for _, job := range jobs {
+		select {
+		case <-cancelContext.Done():
+			break jobloop
+		case jobChan <- job:
+		}
+	}
+	close(jobChan)
+	wg.Wait()
+	return int(failed)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"archive/zip"
+	"data_play/pkg/config"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFlagsEnv(t *testing.T) {
+	assert := assert.New(t)
+	os.Setenv("DATAPLAY_BATCH_SIZE", "42")
+	os.Setenv("DATAPLAY_MODE", "swap")
+	defer os.Unsetenv("DATAPLAY_BATCH_SIZE")
+	defer os.Unsetenv("DATAPLAY_MODE")
+
+	o := &options{}
+	fs := flag.NewFlagSet("load", flag.ContinueOnError)
+	o.loadFlags(fs)
+	err := parseFlags(fs, []string{"-mode", "merge"})
+	assert.Nil(err)
+	assert.Equal(42, o.batchSize)
+	assert.Equal("merge", o.loadMode)
+}
+
+func TestParseFlagsInvalidEnv(t *testing.T) {
+	os.Setenv("DATAPLAY_WORKERS", "many")
+	defer os.Unsetenv("DATAPLAY_WORKERS")
+
+	o := &options{}
+	fs := flag.NewFlagSet("load", flag.ContinueOnError)
+	o.loadFlags(fs)
+	assert.Error(t, parseFlags(fs, []string{}))
+}
+
+func TestConnectionFlags(t *testing.T) {
+	assert := assert.New(t)
+	o := &options{}
+	fs := flag.NewFlagSet("schema", flag.ContinueOnError)
+	o.connectionFlags(fs)
+	err := parseFlags(fs, []string{"-dsn", "host=db", "-max-conns", "3"})
+	assert.Nil(err)
+	assert.Equal(&config.Database{DSN: "host=db", MaxOpenConns: 3}, o.database())
+}
+
+func TestListInputs(t *testing.T) {
+	assert := assert.New(t)
+	dir, _ := ioutil.TempDir("", "TestListInputs")
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "sample_2020-03-29.txt"), []byte{}, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "sample_2020-03-29.txt.rejects"), []byte{}, 0644)
+	os.Mkdir(filepath.Join(dir, "processed.txt"), 0755)
+
+	inputs, err := listInputs(filepath.Join(dir, "*.txt"))
+	assert.Nil(err)
+	assert.Equal([]string{filepath.Join(dir, "sample_2020-03-29.txt")}, inputs)
+
+	ioutil.WriteFile(filepath.Join(dir, "sample_2020-03-30.txt.gz"), []byte{}, 0644)
+	file, _ := os.Create(filepath.Join(dir, "bundle.zip"))
+	archive := zip.NewWriter(file)
+	archive.Create("sample_2020-03-31.txt")
+	archive.Create("readme.md")
+	archive.Close()
+	file.Close()
+	inputs, err = listInputs(filepath.Join(dir, "*.txt"))
+	assert.Nil(err)
+	assert.Equal([]string{
+		filepath.Join(dir, "sample_2020-03-29.txt"),
+		filepath.Join(dir, "sample_2020-03-30.txt.gz"),
+		filepath.Join(dir, "bundle.zip") + "!/sample_2020-03-31.txt",
+	}, inputs)
+}
+
+func TestJobsFromFlags(t *testing.T) {
+	assert := assert.New(t)
+	o := &options{
+		dsn:          "dbname=test",
+		maxConns:     8,
+		dataDir:      "data",
+		specDir:      "specs",
+		ext:          ".txt",
+		batchSize:    10,
+		parseWorkers: 2,
+		loadMode:     "merge",
+		rejects:      true,
+	}
+	cfg, jobs, err := o.jobs()
+	assert.Nil(err)
+	assert.Len(jobs, 1)
+	assert.Equal(filepath.Join("data", "*.txt"), jobs[0].Input)
+	assert.Equal(10, jobs[0].BatchSize)
+	assert.Equal(2, jobs[0].ParseWorkers)
+	assert.False(jobs[0].UseLedger())
+	assert.NotNil(jobs[0].Rejects)
+	assert.Equal("dbname=test", cfg.Databases[jobs[0].Database].DSN)
+	assert.Equal(8, cfg.Databases[jobs[0].Database].MaxOpenConns)
+}
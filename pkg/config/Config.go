@@ -0,0 +1,163 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"runtime"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Config describes named database targets and the load jobs using them.
+// It is read as YAML, so a JSON file works as well.
+type Config struct {
+	Databases map[string]*Database `yaml:"databases"`
+	Jobs      []*Job               `yaml:"jobs"`
+}
+
+type Database struct {
+	DSN string `yaml:"dsn"`
+	// MaxOpenConns bounds the connections of the jobs using the database,
+	// every file inserts with as many writers
+	MaxOpenConns int `yaml:"max_open_conns"`
+}
+
+type Job struct {
+	Name     string `yaml:"name"`
+	Database string `yaml:"database"`
+	// Input is a glob of the data files, like data/*.txt
+	Input   string `yaml:"input"`
+	SpecDir string `yaml:"spec_dir"`
+	// Tables maps a model to the table it loads into, default is the model
+	Tables map[string]string `yaml:"tables"`
+	// Patterns pick the spec of a file by regex on its name, see Pattern
+	Patterns         []*Pattern `yaml:"patterns"`
+	BatchSize        int        `yaml:"batch_size"`
+	Workers          int        `yaml:"workers"`
+	Insert           string     `yaml:"insert"`
+	LoadMode         string     `yaml:"load_mode"`
+	Rejects          *Rejects   `yaml:"rejects"`
+	Ledger           *bool      `yaml:"ledger"`
+	Force            bool       `yaml:"force"`
+	AllowDestructive bool       `yaml:"allow_destructive"`
+	// Lineage adds source_file, source_line and loaded_at to every row
+	Lineage bool `yaml:"lineage"`
+	// Encoding of the data files, default is the encoding of their spec
+	Encoding string `yaml:"encoding"`
+	// MaxRecordLength is the longest line of the data files in bytes,
+	// default is the max of their spec
+	MaxRecordLength int `yaml:"max_record_length"`
+	// ParseWorkers parse one large file in this many ranges at the same
+	// time, 0 or 1 parse it in one go
+	ParseWorkers int `yaml:"parse_workers"`
+}
+
+// Pattern is a regex on the base name of the data files, its model group
+// names the spec and its other named groups are loaded as columns typed by
+// Columns, TEXT by default
+type Pattern struct {
+	Regex   string             `yaml:"regex"`
+	Columns map[string]*Column `yaml:"columns"`
+}
+
+// Column is the datatype of a pattern group, with the format of a DATE or
+// TIMESTAMP and the scale of a DECIMAL
+type Column struct {
+	Type   string `yaml:"type"`
+	Size   int    `yaml:"size"`
+	Format string `yaml:"format"`
+	Scale  int    `yaml:"scale"`
+}
+
+// Rejects is the bad row policy of a job, a zero limit is unset
+type Rejects struct {
+	MaxCount   int     `yaml:"max_count"`
+	MaxPercent float64 `yaml:"max_percent"`
+}
+
+// job defaults when the config leaves them out
+const (
+	DefaultSpecDir   = "specs"
+	DefaultBatchSize = 5000
+	DefaultInsert    = "copy"
+	DefaultLoadMode  = "append"
+)
+
+func Load(filePath string) (*Config, error) {
+	buffer, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(buffer)
+}
+
+func Parse(buffer []byte) (*Config, error) {
+	config := &Config{}
+	err := yaml.UnmarshalStrict(buffer, config)
+	if err != nil {
+		return nil, fmt.Errorf("Fail to parse config, %v", err)
+	}
+	names := make(map[string]bool)
+	for i, job := range config.Jobs {
+		if job.Name == "" {
+			return nil, fmt.Errorf("Job %d has no name", i)
+		}
+		if names[job.Name] {
+			return nil, fmt.Errorf("Job %s is defined twice", job.Name)
+		}
+		names[job.Name] = true
+		if job.Input == "" {
+			return nil, fmt.Errorf("Job %s has no input", job.Name)
+		}
+		if _, ok := config.Databases[job.Database]; !ok {
+			return nil, fmt.Errorf("Job %s uses unknown database %q", job.Name, job.Database)
+		}
+		job.SetDefaults()
+	}
+	return config, nil
+}
+
+// SetDefaults fills the settings a job leaves out
+func (job *Job) SetDefaults() {
+	if job.SpecDir == "" {
+		job.SpecDir = DefaultSpecDir
+	}
+	if job.BatchSize == 0 {
+		job.BatchSize = DefaultBatchSize
+	}
+	if job.Workers == 0 {
+		job.Workers = runtime.GOMAXPROCS(0)
+	}
+	if job.Insert == "" {
+		job.Insert = DefaultInsert
+	}
+	if job.LoadMode == "" {
+		job.LoadMode = DefaultLoadMode
+	}
+}
+
+// UseLedger is true unless the job turns the ledger off
+func (job *Job) UseLedger() bool {
+	return job.Ledger == nil || *job.Ledger
+}
+
+// Select returns the named jobs, or every job when no name is given
+func (c *Config) Select(names ...string) ([]*Job, error) {
+	if len(names) == 0 {
+		return c.Jobs, nil
+	}
+	var jobs []*Job
+	for _, name := range names {
+		found := false
+		for _, job := range c.Jobs {
+			if job.Name == name {
+				jobs = append(jobs, job)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("Unknown job %s", name)
+		}
+	}
+	return jobs, nil
+}
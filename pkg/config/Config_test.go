@@ -0,0 +1,113 @@
+package config
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseYAML(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	config, err := Parse([]byte(`
+databases:
+  warehouse:
+    dsn: host=localhost dbname=dataplay
+    max_open_conns: 8
+jobs:
+  - name: sample
+    database: warehouse
+    input: data/sample_*.txt
+    tables:
+      sample: sample_daily
+    batch_size: 100
+    load_mode: merge
+    rejects:
+      max_count: 10
+      max_percent: 1.5
+    ledger: false
+`))
+	assert.Nil(err)
+	assert.Equal("host=localhost dbname=dataplay", config.Databases["warehouse"].DSN)
+	assert.Equal(8, config.Databases["warehouse"].MaxOpenConns)
+	assert.Equal(&Job{
+		Name:      "sample",
+		Database:  "warehouse",
+		Input:     "data/sample_*.txt",
+		SpecDir:   DefaultSpecDir,
+		Tables:    map[string]string{"sample": "sample_daily"},
+		BatchSize: 100,
+		Workers:   runtime.GOMAXPROCS(0),
+		Insert:    DefaultInsert,
+		LoadMode:  "merge",
+		Rejects:   &Rejects{MaxCount: 10, MaxPercent: 1.5},
+		Ledger:    config.Jobs[0].Ledger,
+	}, config.Jobs[0])
+	assert.False(config.Jobs[0].UseLedger())
+}
+
+func TestParseJSON(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	config, err := Parse([]byte(`{
+		"databases": {"main": {"dsn": "dbname=dataplay"}},
+		"jobs": [{"name": "utf8", "database": "main", "input": "data/utf8_*.txt", "workers": 2}]
+	}`))
+	assert.Nil(err)
+	assert.Equal(2, config.Jobs[0].Workers)
+	assert.Equal(DefaultBatchSize, config.Jobs[0].BatchSize)
+	assert.True(config.Jobs[0].UseLedger())
+}
+
+func TestParseInvalid(t *testing.T) {
+	t.Parallel()
+	cases := []string{
+		`jobs: [{name: a, input: x}]`,
+		`{databases: {db: {}}, jobs: [{database: db, input: x}]}`,
+		`{databases: {db: {}}, jobs: [{name: a, database: db}]}`,
+		`{databases: {db: {}}, jobs: [{name: a, database: db, input: x}, {name: a, database: db, input: y}]}`,
+		`{databases: {db: {}}, jobs: [{name: a, database: db, input: x, batch: 1}]}`,
+	}
+	for _, c := range cases {
+		_, err := Parse([]byte(c))
+		assert.Error(t, err, c)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	config := &Config{Jobs: []*Job{&Job{Name: "a"}, &Job{Name: "b"}}}
+	jobs, err := config.Select()
+	assert.Nil(err)
+	assert.Len(jobs, 2)
+	jobs, err = config.Select("b")
+	assert.Nil(err)
+	assert.Equal("b", jobs[0].Name)
+	_, err = config.Select("c")
+	assert.Error(err)
+}
+
+func TestParsePatterns(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	config, err := Parse([]byte(`
+databases:
+  main:
+    dsn: dbname=dataplay
+jobs:
+  - name: sales
+    database: main
+    input: data/*.txt
+    patterns:
+      - regex: '^(?P<model>daily_sales)_(?P<load_date>\d{8})\.txt$'
+        columns:
+          load_date:
+            type: DATE
+            format: "20060102"
+`))
+	assert.Nil(err)
+	assert.Equal(`^(?P<model>daily_sales)_(?P<load_date>\d{8})\.txt$`, config.Jobs[0].Patterns[0].Regex)
+	assert.Equal(&Column{Type: "DATE", Format: "20060102"}, config.Jobs[0].Patterns[0].Columns["load_date"])
+}
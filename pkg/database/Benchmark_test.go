@@ -0,0 +1,34 @@
+package database
+
+import (
+	"data_play/pkg/parser"
+	"database/sql"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// discardExt is a connection that executes nothing, so the benchmark only
+// measures building the statement and its arguments
+type discardExt struct {
+	sqlx.Ext
+}
+
+func (d discardExt) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return nil, nil
+}
+
+func BenchmarkInsertData(b *testing.B) {
+	rows := make([]*parser.Row, 1000)
+	for i := range rows {
+		rows[i] = sampleRow("abc", true, i)
+	}
+	q := &QueryerImpl{}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := q.InsertData(discardExt{}, "sample", rows); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
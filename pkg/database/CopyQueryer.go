@@ -0,0 +1,67 @@
+package database
+
+import (
+	"data_play/pkg/parser"
+	"database/sql"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// CopyQueryer loads rows with PostgreSQL COPY FROM STDIN instead of a
+// multi-row INSERT, so a buffer is not bound by the 65535 parameter limit.
+// COPY needs a prepared statement, so conn must be a transaction (or any
+// sqlx.Preparer); the caller owns commit and rollback as with QueryerImpl.
+type CopyQueryer struct {
+	QueryerImpl
+}
+
+func (q *CopyQueryer) InsertData(conn sqlx.Ext, tableName string, rows []*parser.Row) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	preparer, ok := conn.(sqlx.Preparer)
+	if !ok {
+		return fmt.Errorf("COPY into %s needs a connection that can prepare statements", tableName)
+	}
+	columns, err := insertColumns(rows)
+	if err != nil {
+		return err
+	}
+	// pq.CopyIn quotes the names, they are only checked here
+	err = CheckIdentifier(tableName)
+	for i := 0; err == nil && i < len(columns); i++ {
+		err = CheckIdentifier(columns[i])
+	}
+	if err != nil {
+		return err
+	}
+
+	var stmt *sql.Stmt
+	stmt, err = preparer.Prepare(pq.CopyIn(tableName, columns...))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for i, row := range rows {
+		if _, err = stmt.Exec(row.Values...); err != nil {
+			return fmt.Errorf("row %d: %v", i, err)
+		}
+	}
+	// an Exec without arguments flushes the buffered COPY data
+	_, err = stmt.Exec()
+	return err
+}
+
+// NewQueryer returns the Queryer for an insert method, "insert" or "copy".
+func NewQueryer(method string) (Queryer, error) {
+	switch method {
+	case "", "insert":
+		return &QueryerImpl{}, nil
+	case "copy":
+		return &CopyQueryer{}, nil
+	}
+	return nil, fmt.Errorf("Unknown insert method %s", method)
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"data_play/pkg/parser"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type CopyQueryerTestSuite struct {
+	suite.Suite
+	sqlxDB  *sqlx.DB
+	mock    sqlmock.Sqlmock
+	queryer Queryer
+}
+
+func (s *CopyQueryerTestSuite) SetupTest() {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		fmt.Println(err)
+	}
+	s.sqlxDB = sqlx.NewDb(mockDB, "sqlmock")
+	s.mock = mock
+	s.queryer = &CopyQueryer{}
+}
+
+func (s *CopyQueryerTestSuite) TearDownTest() {
+	s.sqlxDB.Close()
+}
+
+func (s *CopyQueryerTestSuite) TestInsertDataEmpty() {
+	err := s.queryer.InsertData(s.sqlxDB, "TestInsertDataEmpty", []*parser.Row{})
+	assert.Nil(s.T(), err)
+}
+
+func (s *CopyQueryerTestSuite) TestInsertDataNeedPreparer() {
+	s.mock.ExpectBegin()
+	tx, _ := s.sqlxDB.Beginx()
+	data := []*parser.Row{
+		&parser.Row{Metas: sampleMetas[2:], Values: []interface{}{1}},
+	}
+	err := s.queryer.InsertData(struct{ sqlx.Ext }{tx}, "TestInsertDataNeedPreparer", data)
+	assert.Error(s.T(), err)
+}
+
+func (s *CopyQueryerTestSuite) TestInsertDataMultiple() {
+	data := []*parser.Row{
+		sampleRow("abc", true, 321),
+		sampleRow("世界", false, 123),
+	}
+
+	s.mock.ExpectBegin()
+	prepare := s.mock.ExpectPrepare(
+		`^COPY "TestInsertDataMultiple" \("名前", "active", "count"\) FROM STDIN`,
+	)
+	prepare.ExpectExec().WithArgs("abc", true, 321).WillReturnResult(sqlmock.NewResult(0, 0))
+	prepare.ExpectExec().WithArgs("世界", false, 123).WillReturnResult(sqlmock.NewResult(0, 0))
+	prepare.ExpectExec().WithArgs().WillReturnResult(sqlmock.NewResult(0, 2))
+	tx, _ := s.sqlxDB.Beginx()
+	err := s.queryer.InsertData(tx, "TestInsertDataMultiple", data)
+	assert.Nil(s.T(), err)
+	assert.Nil(s.T(), s.mock.ExpectationsWereMet())
+}
+
+func (s *CopyQueryerTestSuite) TestInsertDataFail() {
+	data := []*parser.Row{
+		&parser.Row{Metas: sampleMetas[2:], Values: []interface{}{1}},
+	}
+
+	s.mock.ExpectBegin()
+	prepare := s.mock.ExpectPrepare(`^COPY "TestInsertDataFail"`)
+	prepare.ExpectExec().WithArgs(1).WillReturnError(fmt.Errorf("whatever"))
+	tx, _ := s.sqlxDB.Beginx()
+	err := s.queryer.InsertData(tx, "TestInsertDataFail", data)
+	assert.Error(s.T(), err)
+}
+
+func TestCopyQueryer(t *testing.T) {
+	suite.Run(t, new(CopyQueryerTestSuite))
+}
+
+func TestNewQueryer(t *testing.T) {
+	assert := assert.New(t)
+	q, err := NewQueryer("copy")
+	assert.Nil(err)
+	assert.IsType(&CopyQueryer{}, q)
+	q, err = NewQueryer("")
+	assert.Nil(err)
+	assert.IsType(&QueryerImpl{}, q)
+	_, err = NewQueryer("unknown")
+	assert.Error(err)
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+)
+
+// maxIdentifierLength is the bytes of a name postgres keeps, NAMEDATALEN - 1,
+// a longer name would be silently cut and could hit another table
+const maxIdentifierLength = 63
+
+// stagingInfix goes between a table name and the time of its staging table
+const stagingInfix = "_staging_"
+
+// CheckIdentifier refuses a table or column name which is empty, too long
+// for postgres or not only letters, digits, _, $ and -. Letters of any
+// script and mixed case are fine, they are always quoted.
+func CheckIdentifier(name string) error {
+	if name == "" {
+		return fmt.Errorf("Invalid identifier, empty name")
+	}
+	if len(name) > maxIdentifierLength {
+		return fmt.Errorf("Invalid identifier %q, longer than %d bytes", name, maxIdentifierLength)
+	}
+	if !utf8.ValidString(name) {
+		return fmt.Errorf("Invalid identifier %q, not utf-8", name)
+	}
+	for _, r := range name {
+		switch {
+		case unicode.IsLetter(r), unicode.IsMark(r), unicode.IsDigit(r):
+		case r == '_', r == '$', r == '-':
+		default:
+			return fmt.Errorf("Invalid identifier %q, %q is not allowed", name, r)
+		}
+	}
+	return nil
+}
+
+// QuoteIdentifier checks name and quotes it for SQL, so keywords like order,
+// names like 名前 and mixed case are kept exactly
+func QuoteIdentifier(name string) (string, error) {
+	if err := CheckIdentifier(name); err != nil {
+		return "", err
+	}
+	return pq.QuoteIdentifier(name), nil
+}
+
+// quoteExisting quotes a name read back from the database, postgres took
+// it already so it is not checked
+func quoteExisting(name string) string {
+	return pq.QuoteIdentifier(name)
+}
+
+func quoteIdentifiers(names []string) ([]string, error) {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		var err error
+		quoted[i], err = QuoteIdentifier(name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return quoted, nil
+}
+
+// StagingName is the name of a staging table of tableName made at now, the
+// table name is cut on a rune so the whole name stays a valid identifier
+func StagingName(tableName string, now time.Time) string {
+	suffix := stagingInfix + strconv.FormatInt(now.UnixNano(), 10)
+	prefix := tableName
+	for len(prefix)+len(suffix) > maxIdentifierLength {
+		_, size := utf8.DecodeLastRuneInString(prefix)
+		prefix = prefix[:len(prefix)-size]
+	}
+	return prefix + suffix
+}
@@ -0,0 +1,45 @@
+package database
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckIdentifier(t *testing.T) {
+	assert := assert.New(t)
+	for _, name := range []string{"sample", "名前", "DailySales", "order", "sample-eu", "price$", "_2020", strings.Repeat("a", 63)} {
+		assert.Nil(CheckIdentifier(name), name)
+	}
+	for _, name := range []string{"", "x;drop table y", "first name", `say"hi`, "a.b", "tab\t", "\xff", strings.Repeat("a", 64), strings.Repeat("名", 22)} {
+		assert.Error(CheckIdentifier(name), name)
+	}
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	assert := assert.New(t)
+	quoted, err := QuoteIdentifier("order")
+	assert.Nil(err)
+	assert.Equal(`"order"`, quoted)
+	quoted, err = QuoteIdentifier("DailySales")
+	assert.Nil(err)
+	assert.Equal(`"DailySales"`, quoted)
+	_, err = QuoteIdentifier("x;drop table y")
+	assert.Error(err)
+}
+
+func TestStagingName(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Unix(1585440000, 123)
+	assert.Equal("sample_staging_1585440000000000123", StagingName("sample", now))
+
+	for _, table := range []string{strings.Repeat("a", 63), strings.Repeat("名", 21)} {
+		name := StagingName(table, now)
+		assert.Nil(CheckIdentifier(name), name)
+		assert.True(utf8.ValidString(name))
+		assert.True(strings.HasSuffix(name, "_staging_1585440000000000123"))
+	}
+}
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ledger status of a file load
+const (
+	LedgerRunning = "running"
+	LedgerSuccess = "success"
+	LedgerFailed  = "failed"
+)
+
+const DefaultLedgerTable = "dataplay_ledger"
+
+type LedgerEntry struct {
+	FileName    string
+	FileSize    int64
+	Checksum    string
+	SpecVersion string
+}
+
+// Ledger records every file load so a rerun can skip the files which are
+// already loaded
+type Ledger interface {
+	Init(conn sqlx.Execer) error
+	IsLoaded(conn sqlx.Queryer, entry *LedgerEntry) (bool, error)
+	Begin(conn sqlx.Queryer, entry *LedgerEntry) (int64, error)
+	Finish(conn sqlx.Execer, id int64, status string, rowCount int) error
+}
+
+type LedgerImpl struct {
+	TableName string
+}
+
+func NewLedger() Ledger {
+	return &LedgerImpl{TableName: DefaultLedgerTable}
+}
+
+func (l *LedgerImpl) Init(conn sqlx.Execer) error {
+	sqlTmpl := `CREATE TABLE IF NOT EXISTS %s (
+		id BIGSERIAL PRIMARY KEY,
+		file_name TEXT NOT NULL,
+		file_size BIGINT NOT NULL,
+		checksum VARCHAR(64) NOT NULL,
+		spec_version VARCHAR(64) NOT NULL,
+		row_count BIGINT NOT NULL DEFAULT 0,
+		status VARCHAR(16) NOT NULL,
+		started_at TIMESTAMP NOT NULL DEFAULT now(),
+		finished_at TIMESTAMP
+	)`
+	table, err := QuoteIdentifier(l.TableName)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Exec(fmt.Sprintf(sqlTmpl, table))
+	return err
+}
+
+// IsLoaded tells if the same content of the file was loaded successfully
+func (l *LedgerImpl) IsLoaded(conn sqlx.Queryer, entry *LedgerEntry) (bool, error) {
+	sqlTmpl := `SELECT EXISTS (SELECT 1 FROM %s WHERE file_name = $1 AND checksum = $2 AND status = $3)`
+	table, err := QuoteIdentifier(l.TableName)
+	if err != nil {
+		return false, err
+	}
+	var loaded bool
+	err = conn.QueryRowx(
+		fmt.Sprintf(sqlTmpl, table), entry.FileName, entry.Checksum, LedgerSuccess,
+	).Scan(&loaded)
+	return loaded, err
+}
+
+func (l *LedgerImpl) Begin(conn sqlx.Queryer, entry *LedgerEntry) (int64, error) {
+	sqlTmpl := `INSERT INTO %s (file_name, file_size, checksum, spec_version, status)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id`
+	table, err := QuoteIdentifier(l.TableName)
+	if err != nil {
+		return 0, err
+	}
+	var id int64
+	err = conn.QueryRowx(
+		fmt.Sprintf(sqlTmpl, table),
+		entry.FileName, entry.FileSize, entry.Checksum, entry.SpecVersion, LedgerRunning,
+	).Scan(&id)
+	return id, err
+}
+
+func (l *LedgerImpl) Finish(conn sqlx.Execer, id int64, status string, rowCount int) error {
+	sqlTmpl := `UPDATE %s SET status = $1, row_count = $2, finished_at = now() WHERE id = $3`
+	table, err := QuoteIdentifier(l.TableName)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Exec(fmt.Sprintf(sqlTmpl, table), status, rowCount, id)
+	return err
+}
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type LedgerTestSuite struct {
+	suite.Suite
+	sqlxDB *sqlx.DB
+	mock   sqlmock.Sqlmock
+	ledger Ledger
+	entry  *LedgerEntry
+}
+
+func (s *LedgerTestSuite) SetupSuite() {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		fmt.Println(err)
+	}
+	s.sqlxDB = sqlx.NewDb(mockDB, "sqlmock")
+	s.mock = mock
+	s.ledger = NewLedger()
+	s.entry = &LedgerEntry{
+		FileName:    "sample_2020-03-29.txt",
+		FileSize:    300,
+		Checksum:    "abc",
+		SpecVersion: "def",
+	}
+}
+
+func (s *LedgerTestSuite) TearDownSuite() {
+	s.sqlxDB.Close()
+}
+
+func (s *LedgerTestSuite) TestInit() {
+	s.mock.ExpectExec(`^CREATE TABLE IF NOT EXISTS "dataplay_ledger"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	err := s.ledger.Init(s.sqlxDB)
+	assert.Nil(s.T(), err)
+}
+
+func (s *LedgerTestSuite) TestIsLoaded() {
+	s.mock.ExpectQuery(`^SELECT EXISTS \(SELECT 1 FROM "dataplay_ledger"`).
+		WithArgs("sample_2020-03-29.txt", "abc", LedgerSuccess).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	loaded, err := s.ledger.IsLoaded(s.sqlxDB, s.entry)
+	assert.Nil(s.T(), err)
+	assert.True(s.T(), loaded)
+}
+
+func (s *LedgerTestSuite) TestBeginAndFinish() {
+	s.mock.ExpectQuery(`^INSERT INTO "dataplay_ledger" .* RETURNING id`).
+		WithArgs("sample_2020-03-29.txt", int64(300), "abc", "def", LedgerRunning).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	s.mock.ExpectExec(`^UPDATE "dataplay_ledger" SET status`).
+		WithArgs(LedgerSuccess, 42, int64(7)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	id, err := s.ledger.Begin(s.sqlxDB, s.entry)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), int64(7), id)
+	err = s.ledger.Finish(s.sqlxDB, id, LedgerSuccess, 42)
+	assert.Nil(s.T(), err)
+}
+
+func TestLedger(t *testing.T) {
+	suite.Run(t, new(LedgerTestSuite))
+}
@@ -11,7 +11,13 @@ import (
 
 type Queryer interface {
 	CreateTable(conn sqlx.Execer, tableName string, metas []*parser.SQLMeta) error
-	InsertData(conn sqlx.Ext, tableName string, rows []*map[string]interface{}) error
+	// InsertData inserts rows into the columns of their metas, in spec order,
+	// every row must have the columns of the first one
+	InsertData(conn sqlx.Ext, tableName string, rows []*parser.Row) error
+	CreateStagingTable(conn sqlx.Execer, tableName, stagingName string) error
+	PromoteStagingTable(conn sqlx.Execer, stagingName, tableName string, replace bool) error
+	DropTable(conn sqlx.Execer, tableName string) error
+	MigrateTable(conn sqlx.Ext, tableName string, metas []*parser.SQLMeta, allowDestructive bool) error
 }
 
 type QueryerImpl struct{}
@@ -20,27 +26,73 @@ func (q *QueryerImpl) CreateTable(conn sqlx.Execer, tableName string, metas []*p
 	sqlTmpl := `CREATE TABLE IF NOT EXISTS %s (
 		%s
 	)`
+	table, err := QuoteIdentifier(tableName)
+	if err != nil {
+		return err
+	}
 	var rows []string
 	for _, meta := range metas {
-		rows = append(rows, createRowStmt(meta))
+		row, err := createRowStmt(meta)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, row)
+	}
+	sql := fmt.Sprintf(sqlTmpl, table, strings.Join(rows, ",\n"))
+	_, err = conn.Exec(sql)
+	return err
+}
+
+// CreateStagingTable creates an empty unlogged copy of tableName
+func (q *QueryerImpl) CreateStagingTable(conn sqlx.Execer, tableName, stagingName string) error {
+	names, err := quoteIdentifiers([]string{stagingName, tableName})
+	if err != nil {
+		return err
 	}
-	sql := fmt.Sprintf(sqlTmpl, tableName, strings.Join(rows, ",\n"))
-	_, err := conn.Exec(sql)
+	sql := fmt.Sprintf(`CREATE UNLOGGED TABLE %s (LIKE %s INCLUDING DEFAULTS)`, names[0], names[1])
+	_, err = conn.Exec(sql)
 	return err
 }
 
-func createRowStmt(meta *parser.SQLMeta) string {
-	switch meta.DataType {
-	case "INTEGER":
-		return fmt.Sprintf("%s NUMERIC(%d)", meta.Name, meta.Size)
-	case "BOOLEAN":
-		return fmt.Sprintf("%s BOOLEAN", meta.Name)
-	case "TEXT":
-		if meta.Size < 256 {
-			return fmt.Sprintf("%s VARCHAR(%d)", meta.Name, meta.Size)
+// PromoteStagingTable moves the staged rows into tableName and drops the
+// staging table, replace empties tableName first. conn should be a
+// transaction so readers never see a half promoted table.
+func (q *QueryerImpl) PromoteStagingTable(conn sqlx.Execer, stagingName, tableName string, replace bool) error {
+	names, err := quoteIdentifiers([]string{tableName, stagingName})
+	if err != nil {
+		return err
+	}
+	if replace {
+		_, err = conn.Exec(fmt.Sprintf(`TRUNCATE TABLE %s`, names[0]))
+		if err != nil {
+			return err
 		}
 	}
-	return fmt.Sprintf("%s TEXT", meta.Name)
+	_, err = conn.Exec(fmt.Sprintf(`INSERT INTO %s SELECT * FROM %s`, names[0], names[1]))
+	if err != nil {
+		return err
+	}
+	return q.DropTable(conn, stagingName)
+}
+
+func (q *QueryerImpl) DropTable(conn sqlx.Execer, tableName string) error {
+	table, err := QuoteIdentifier(tableName)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Exec(fmt.Sprintf(`DROP TABLE IF EXISTS %s`, table))
+	return err
+}
+
+func createRowStmt(meta *parser.SQLMeta) (string, error) {
+	name, err := QuoteIdentifier(meta.Name)
+	if err != nil {
+		return "", err
+	}
+	if meta.Nullable {
+		return name + " " + specColumn(meta).String(), nil
+	}
+	return name + " " + specColumn(meta).String() + " NOT NULL", nil
 }
 
 func intRange(min, max int) []int {
@@ -58,29 +110,76 @@ func toPlaceHolder(arr []int) string {
 	return "(" + strings.Join(str, ", ") + ")"
 }
 
-func (q *QueryerImpl) InsertData(conn sqlx.Ext, tableName string, rows []*map[string]interface{}) error {
-	sqlTmpl := `INSERT INTO %s (%s) VALUES %s;`
-	var columns []string
+// maxBindParams is the most parameters of a postgres statement, a batch of
+// more values is inserted in several statements
+const maxBindParams = 65535
+
+func (q *QueryerImpl) InsertData(conn sqlx.Ext, tableName string, rows []*parser.Row) error {
 	if len(rows) == 0 {
 		return nil
 	}
-	for k := range *rows[0] {
-		columns = append(columns, k)
+	columns, err := insertColumns(rows)
+	if err != nil {
+		return err
 	}
-	var placeholders []string
-	var values []interface{}
-	for i, row := range rows {
-		pos := i * len(columns)
-		holder := toPlaceHolder(intRange(pos+1, pos+len(columns)))
-		placeholders = append(placeholders, holder)
-		var val []interface{}
-		for _, k := range columns {
-			val = append(val, (*row)[k])
+	table, err := QuoteIdentifier(tableName)
+	if err != nil {
+		return err
+	}
+	quoted, err := quoteIdentifiers(columns)
+	if err != nil {
+		return err
+	}
+	size := maxBindParams / len(columns)
+	for start := 0; start < len(rows); start += size {
+		end := start + size
+		if end > len(rows) {
+			end = len(rows)
+		}
+		err = insertStatement(conn, table, quoted, rows[start:end])
+		if err != nil {
+			return err
 		}
-		values = append(values, val...)
 	}
+	return nil
+}
 
-	sql := fmt.Sprintf(sqlTmpl, tableName, strings.Join(columns, ", "), strings.Join(placeholders, ", "))
+// insertStatement inserts rows in a single statement into the quoted table
+// and columns
+func insertStatement(conn sqlx.Ext, table string, columns []string, rows []*parser.Row) error {
+	sqlTmpl := `INSERT INTO %s (%s) VALUES %s;`
+	placeholders := make([]string, 0, len(rows))
+	values := make([]interface{}, 0, len(rows)*len(columns))
+	for i, row := range rows {
+		pos := i * len(columns)
+		placeholders = append(placeholders, toPlaceHolder(intRange(pos+1, pos+len(columns))))
+		values = append(values, row.Values...)
+	}
+	sql := fmt.Sprintf(sqlTmpl, table, strings.Join(columns, ", "), strings.Join(placeholders, ", "))
 	_, err := conn.Exec(sql, values...)
 	return err
 }
+
+// insertColumns returns the columns of the first row and checks every row
+// has the same ones so no value lands in another column
+func insertColumns(rows []*parser.Row) ([]string, error) {
+	columns := rows[0].Columns()
+	for i, row := range rows {
+		if !sameColumns(row, rows[0]) {
+			return nil, fmt.Errorf("Row %d has columns %s instead of %s", i, strings.Join(row.Columns(), ", "), strings.Join(columns, ", "))
+		}
+	}
+	return columns, nil
+}
+
+func sameColumns(row, first *parser.Row) bool {
+	if len(row.Values) != len(row.Metas) || len(row.Metas) != len(first.Metas) {
+		return false
+	}
+	for i, meta := range row.Metas {
+		if meta != first.Metas[i] && meta.Name != first.Metas[i].Name {
+			return false
+		}
+	}
+	return true
+}
@@ -57,72 +57,172 @@ func (s *QueryerTestSuite) TestCreateTableSuccess() {
 		},
 	}
 
-	s.mock.ExpectExec("^CREATE TABLE IF NOT EXISTS TestCreateTableSuccess .* name VARCHAR\\(10\\), 名前 TEXT, active BOOLEAN, count NUMERIC\\(8\\), what TEXT .*").WillReturnResult(sqlmock.NewResult(1, 1))
+	s.mock.ExpectExec(`^CREATE TABLE IF NOT EXISTS "TestCreateTableSuccess" .* "name" VARCHAR\(10\) NOT NULL, "名前" TEXT NOT NULL, "active" BOOLEAN NOT NULL, "count" NUMERIC\(8\) NOT NULL, "what" TEXT NOT NULL .*`).WillReturnResult(sqlmock.NewResult(1, 1))
 	err := s.queryer.CreateTable(s.sqlxDB, "TestCreateTableSuccess", meta)
 	assert.Nil(s.T(), err)
 }
 
+func (s *QueryerTestSuite) TestCreateTableTypes() {
+	meta := []*parser.SQLMeta{
+		&parser.SQLMeta{Name: "day", Size: 8, DataType: "DATE"},
+		&parser.SQLMeta{Name: "at", Size: 14, DataType: "TIMESTAMP"},
+		&parser.SQLMeta{Name: "amount", Size: 9, DataType: "DECIMAL", Scale: 2, Nullable: true},
+		&parser.SQLMeta{Name: "big", Size: 12, DataType: "BIGINT"},
+		&parser.SQLMeta{Name: "ratio", Size: 5, DataType: "FLOAT"},
+	}
+
+	s.mock.ExpectExec(`^CREATE TABLE IF NOT EXISTS "TestCreateTableTypes" .* "day" DATE NOT NULL, "at" TIMESTAMP NOT NULL, "amount" NUMERIC\(9, 2\), "big" BIGINT NOT NULL, "ratio" DOUBLE PRECISION NOT NULL .*`).WillReturnResult(sqlmock.NewResult(0, 0))
+	err := s.queryer.CreateTable(s.sqlxDB, "TestCreateTableTypes", meta)
+	assert.Nil(s.T(), err)
+}
+
 func (s *QueryerTestSuite) TestCreateTableFail() {
 	meta := []*parser.SQLMeta{}
 
-	s.mock.ExpectExec("^CREATE TABLE IF NOT EXISTS TestCreateTableSuccess").WillReturnError(fmt.Errorf("sth wrong"))
+	s.mock.ExpectExec(`^CREATE TABLE IF NOT EXISTS "TestCreateTableSuccess"`).WillReturnError(fmt.Errorf("sth wrong"))
 	err := s.queryer.CreateTable(s.sqlxDB, "TestCreateTableSuccess", meta)
 	assert.Error(s.T(), err)
 }
 
-func (s *QueryerTestSuite) TestInsertDataSingle() {
-	data := []*map[string]interface{}{
-		&map[string]interface{}{
-			"名前":     "abc",
-			"active": true,
-			"count":  321,
-		},
+func (s *QueryerTestSuite) TestCreateTableKeyword() {
+	meta := []*parser.SQLMeta{
+		&parser.SQLMeta{Name: "order", Size: 5, DataType: "INTEGER"},
+		&parser.SQLMeta{Name: "UserName", Size: 10, DataType: "TEXT"},
 	}
 
+	s.mock.ExpectExec(`^CREATE TABLE IF NOT EXISTS "DailySales" .* "order" NUMERIC\(5\) NOT NULL, "UserName" VARCHAR\(10\) NOT NULL .*`).WillReturnResult(sqlmock.NewResult(0, 0))
+	err := s.queryer.CreateTable(s.sqlxDB, "DailySales", meta)
+	assert.Nil(s.T(), err)
+}
+
+func (s *QueryerTestSuite) TestInvalidIdentifiers() {
+	meta := []*parser.SQLMeta{&parser.SQLMeta{Name: "name", Size: 10, DataType: "TEXT"}}
+	assert.Error(s.T(), s.queryer.CreateTable(s.sqlxDB, "x;drop table y", meta))
+	meta = []*parser.SQLMeta{&parser.SQLMeta{Name: "a); drop table y; --", Size: 10, DataType: "TEXT"}}
+	assert.Error(s.T(), s.queryer.CreateTable(s.sqlxDB, "sample", meta))
+
+	data := []*parser.Row{&parser.Row{Metas: meta[:1], Values: []interface{}{1}}}
+	assert.Error(s.T(), s.queryer.InsertData(s.sqlxDB, "sample", data))
+	assert.Error(s.T(), s.queryer.DropTable(s.sqlxDB, "sample;"))
+	assert.Error(s.T(), s.queryer.CreateStagingTable(s.sqlxDB, "sample", "sample staging"))
+	// nothing reached the database
+	assert.Nil(s.T(), s.mock.ExpectationsWereMet())
+}
+
+// sampleMetas are the columns of the insert tests, in spec order
+var sampleMetas = []*parser.SQLMeta{
+	&parser.SQLMeta{Name: "名前", Size: 10, DataType: "TEXT"},
+	&parser.SQLMeta{Name: "active", DataType: "BOOL"},
+	&parser.SQLMeta{Name: "count", DataType: "INT"},
+}
+
+func sampleRow(values ...interface{}) *parser.Row {
+	return &parser.Row{Metas: sampleMetas, Values: values}
+}
+
+func (s *QueryerTestSuite) TestInsertDataSingle() {
+	data := []*parser.Row{sampleRow("abc", true, 321)}
+
 	s.mock.ExpectExec(
-		"^INSERT INTO TestInsertDataSingle \\(名前, active, count\\) VALUES \\(\\$1, \\$2, \\$3\\)",
+		`^INSERT INTO "TestInsertDataSingle" \("名前", "active", "count"\) VALUES \(\$1, \$2, \$3\)`,
 	).WillReturnResult(sqlmock.NewResult(1, 1))
 	err := s.queryer.InsertData(s.sqlxDB, "TestInsertDataSingle", data)
 	assert.Nil(s.T(), err)
 }
 
 func (s *QueryerTestSuite) TestInsertDataMultiple() {
-	data := []*map[string]interface{}{
-		&map[string]interface{}{
-			"名前":     "abc",
-			"active": true,
-			"count":  321,
-		},
-		&map[string]interface{}{
-			"名前":     "世界",
-			"active": false,
-			"count":  123,
-		},
+	data := []*parser.Row{
+		sampleRow("abc", true, 321),
+		sampleRow("世界", false, 123),
 	}
 
 	s.mock.ExpectExec(
-		"^INSERT INTO TestInsertDataSingle \\(名前, active, count\\) VALUES \\(\\$1, \\$2, \\$3\\), \\(\\$4, \\$5, \\$6\\)",
+		`^INSERT INTO "TestInsertDataSingle" \("名前", "active", "count"\) VALUES \(\$1, \$2, \$3\), \(\$4, \$5, \$6\)`,
 	).WithArgs("abc", true, 321, "世界", false, 123).WillReturnResult(sqlmock.NewResult(1, 1))
 	err := s.queryer.InsertData(s.sqlxDB, "TestInsertDataSingle", data)
 	assert.Nil(s.T(), err)
 }
 
 func (s *QueryerTestSuite) TestInsertDataFail() {
-	data := []*map[string]interface{}{
-		&map[string]interface{}{
-			"名前":     "abc",
-			"active": true,
-			"count":  321,
-		},
-	}
+	data := []*parser.Row{sampleRow("abc", true, 321)}
 
 	s.mock.ExpectExec(
-		"^INSERT INTO TestInsertDataSingle",
+		`^INSERT INTO "TestInsertDataSingle"`,
 	).WillReturnError(fmt.Errorf("whatever"))
 	err := s.queryer.InsertData(s.sqlxDB, "TestInsertDataSingle", data)
 	assert.Error(s.T(), err)
 }
 
+func (s *QueryerTestSuite) TestInsertDataWide() {
+	// 20 columns take 3276 rows per statement under the 65535 parameters
+	metas := make([]*parser.SQLMeta, 20)
+	for i := range metas {
+		metas[i] = &parser.SQLMeta{Name: fmt.Sprintf("c%d", i), Size: 5, DataType: "INTEGER"}
+	}
+	data := make([]*parser.Row, 5000)
+	for i := range data {
+		data[i] = &parser.Row{Metas: metas, Values: make([]interface{}, len(metas))}
+	}
+
+	s.mock.ExpectExec(`^INSERT INTO "TestInsertDataWide" .*\(\$65501, .*, \$65520\);$`).WillReturnResult(sqlmock.NewResult(0, 3276))
+	s.mock.ExpectExec(`^INSERT INTO "TestInsertDataWide" .*\(\$34461, .*, \$34480\);$`).WillReturnResult(sqlmock.NewResult(0, 1724))
+	err := s.queryer.InsertData(s.sqlxDB, "TestInsertDataWide", data)
+	assert.Nil(s.T(), err)
+	assert.Nil(s.T(), s.mock.ExpectationsWereMet())
+}
+
+func (s *QueryerTestSuite) TestInsertDataMetasOrder() {
+	metas := []*parser.SQLMeta{sampleMetas[2], sampleMetas[0], sampleMetas[1]}
+	data := []*parser.Row{&parser.Row{Metas: metas, Values: []interface{}{321, "abc", true}}}
+
+	s.mock.ExpectExec(
+		`^INSERT INTO "TestInsertDataMetasOrder" \("count", "名前", "active"\) VALUES \(\$1, \$2, \$3\)`,
+	).WithArgs(321, "abc", true).WillReturnResult(sqlmock.NewResult(1, 1))
+	err := s.queryer.InsertData(s.sqlxDB, "TestInsertDataMetasOrder", data)
+	assert.Nil(s.T(), err)
+}
+
+func (s *QueryerTestSuite) TestInsertDataMismatchedRows() {
+	data := []*parser.Row{
+		sampleRow("abc", true, 321),
+		&parser.Row{Metas: []*parser.SQLMeta{sampleMetas[0], sampleMetas[2]}, Values: []interface{}{"世界", 123}},
+	}
+	err := s.queryer.InsertData(s.sqlxDB, "TestInsertDataMismatchedRows", data)
+	assert.EqualError(s.T(), err, "Row 1 has columns 名前, count instead of 名前, active, count")
+
+	data = []*parser.Row{
+		sampleRow("abc", true, 321),
+		&parser.Row{Metas: sampleMetas, Values: []interface{}{"世界", false}},
+	}
+	err = s.queryer.InsertData(s.sqlxDB, "TestInsertDataMismatchedRows", data)
+	assert.Error(s.T(), err)
+	assert.Nil(s.T(), s.mock.ExpectationsWereMet())
+}
+
+func (s *QueryerTestSuite) TestCreateStagingTable() {
+	s.mock.ExpectExec(
+		`^CREATE UNLOGGED TABLE "sample_staging" \(LIKE "sample" INCLUDING DEFAULTS\)`,
+	).WillReturnResult(sqlmock.NewResult(0, 0))
+	err := s.queryer.CreateStagingTable(s.sqlxDB, "sample", "sample_staging")
+	assert.Nil(s.T(), err)
+}
+
+func (s *QueryerTestSuite) TestPromoteStagingTableMerge() {
+	s.mock.ExpectExec(`^INSERT INTO "sample" SELECT \* FROM "sample_staging"`).WillReturnResult(sqlmock.NewResult(0, 3))
+	s.mock.ExpectExec(`^DROP TABLE IF EXISTS "sample_staging"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	err := s.queryer.PromoteStagingTable(s.sqlxDB, "sample_staging", "sample", false)
+	assert.Nil(s.T(), err)
+	assert.Nil(s.T(), s.mock.ExpectationsWereMet())
+}
+
+func (s *QueryerTestSuite) TestPromoteStagingTableReplace() {
+	s.mock.ExpectExec(`^TRUNCATE TABLE "sample"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectExec(`^INSERT INTO "sample" SELECT \* FROM "sample_staging"`).WillReturnError(fmt.Errorf("whatever"))
+	err := s.queryer.PromoteStagingTable(s.sqlxDB, "sample_staging", "sample", true)
+	assert.Error(s.T(), err)
+	assert.Nil(s.T(), s.mock.ExpectationsWereMet())
+}
+
 func (s *QueryerTestSuite) TearDownSuite() {
 	s.sqlxDB.Close()
 }
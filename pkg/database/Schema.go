@@ -0,0 +1,198 @@
+package database
+
+import (
+	"data_play/pkg/parser"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// columnDef is a column type as both the spec and information_schema see it
+type columnDef struct {
+	kind      string
+	length    int
+	precision int
+	scale     int
+}
+
+func specColumn(meta *parser.SQLMeta) columnDef {
+	switch meta.DataType {
+	case "INTEGER":
+		return columnDef{kind: "NUMERIC", precision: meta.Size}
+	case "BIGINT":
+		return columnDef{kind: "BIGINT"}
+	case "FLOAT":
+		return columnDef{kind: "DOUBLE PRECISION"}
+	case "DECIMAL":
+		return columnDef{kind: "NUMERIC", precision: meta.Size, scale: meta.Scale}
+	case "BOOLEAN":
+		return columnDef{kind: "BOOLEAN"}
+	case "DATE":
+		return columnDef{kind: "DATE"}
+	case "TIMESTAMP":
+		return columnDef{kind: "TIMESTAMP"}
+	case "TEXT":
+		if meta.Size < 256 {
+			return columnDef{kind: "VARCHAR", length: meta.Size}
+		}
+	}
+	return columnDef{kind: "TEXT"}
+}
+
+func (c columnDef) String() string {
+	switch {
+	case c.kind == "VARCHAR":
+		return fmt.Sprintf("VARCHAR(%d)", c.length)
+	case c.kind == "NUMERIC" && c.scale > 0:
+		return fmt.Sprintf("NUMERIC(%d, %d)", c.precision, c.scale)
+	case c.kind == "NUMERIC" && c.precision > 0:
+		return fmt.Sprintf("NUMERIC(%d)", c.precision)
+	}
+	return c.kind
+}
+
+// widens tells if every value of c fits in to without a cast that can fail
+func (c columnDef) widens(to columnDef) bool {
+	switch {
+	case c.kind == "VARCHAR" && to.kind == "VARCHAR":
+		return to.length >= c.length
+	case c.kind == "VARCHAR" && to.kind == "TEXT":
+		return true
+	case c.kind == "NUMERIC" && to.kind == "NUMERIC":
+		return to.scale >= c.scale && to.precision-to.scale >= c.precision-c.scale
+	}
+	return false
+}
+
+type tableColumn struct {
+	Name      string         `db:"column_name"`
+	DataType  string         `db:"data_type"`
+	Length    sql.NullInt64  `db:"character_maximum_length"`
+	Precision sql.NullInt64  `db:"numeric_precision"`
+	Scale     sql.NullInt64  `db:"numeric_scale"`
+	Nullable  string         `db:"is_nullable"`
+	Comment   sql.NullString `db:"column_comment"`
+}
+
+// extraComment marks the columns of metas with Extra, so a migration with a
+// spec that does not have them keeps them
+const extraComment = "dataplay extra column"
+
+func (c *tableColumn) def() columnDef {
+	switch c.DataType {
+	case "character varying":
+		return columnDef{kind: "VARCHAR", length: int(c.Length.Int64)}
+	case "numeric":
+		return columnDef{kind: "NUMERIC", precision: int(c.Precision.Int64), scale: int(c.Scale.Int64)}
+	case "timestamp without time zone":
+		return columnDef{kind: "TIMESTAMP"}
+	}
+	return columnDef{kind: strings.ToUpper(c.DataType)}
+}
+
+func (q *QueryerImpl) tableColumns(conn sqlx.Queryer, tableName string) ([]*tableColumn, error) {
+	var columns []*tableColumn
+	err := sqlx.Select(conn, &columns, `SELECT column_name, data_type, character_maximum_length,
+		numeric_precision, numeric_scale, is_nullable,
+		col_description((quote_ident(table_schema) || '.' || quote_ident(table_name))::regclass, ordinal_position::int) AS column_comment
+		FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = $1
+		ORDER BY ordinal_position`, tableName)
+	return columns, err
+}
+
+// MigrateTable brings an existing table in line with the spec. New columns
+// are added as nullable since the table may have rows already, columns are
+// widened when every existing value still fits and a column gone from the
+// spec loses its NOT NULL so inserts keep working. Narrowing or changing a
+// type and dropping a column are destructive, MigrateTable refuses them
+// before altering anything unless allowDestructive is set. Extra columns are
+// marked with a comment and never dropped, a load without the lineage or
+// the file name groups keeps them.
+func (q *QueryerImpl) MigrateTable(conn sqlx.Ext, tableName string, metas []*parser.SQLMeta, allowDestructive bool) error {
+	table, err := QuoteIdentifier(tableName)
+	if err != nil {
+		return err
+	}
+	columns, err := q.tableColumns(conn, tableName)
+	if err != nil {
+		return fmt.Errorf("Fail to read columns of %s, %v", tableName, err)
+	}
+	existing := make(map[string]*tableColumn)
+	for _, column := range columns {
+		existing[column.Name] = column
+	}
+
+	var safe []string
+	var destructive []string
+	for _, meta := range metas {
+		name, err := QuoteIdentifier(meta.Name)
+		if err != nil {
+			return err
+		}
+		wanted := specColumn(meta)
+		column, ok := existing[meta.Name]
+		if !ok {
+			safe = append(safe, fmt.Sprintf("ADD COLUMN IF NOT EXISTS %s %s", name, wanted))
+			continue
+		}
+		delete(existing, meta.Name)
+		current := column.def()
+		if current != wanted {
+			if current.widens(wanted) {
+				safe = append(safe, fmt.Sprintf("ALTER COLUMN %s TYPE %s", name, wanted))
+			} else {
+				destructive = append(destructive, fmt.Sprintf("ALTER COLUMN %s TYPE %s USING %s::%s", name, wanted, name, wanted))
+			}
+		}
+		if meta.Nullable && column.Nullable == "NO" {
+			safe = append(safe, fmt.Sprintf("ALTER COLUMN %s DROP NOT NULL", name))
+		}
+	}
+	for _, column := range columns {
+		if _, ok := existing[column.Name]; !ok {
+			continue
+		}
+		if allowDestructive && column.Comment.String != extraComment {
+			destructive = append(destructive, fmt.Sprintf("DROP COLUMN %s", quoteExisting(column.Name)))
+		} else if column.Nullable == "NO" {
+			safe = append(safe, fmt.Sprintf("ALTER COLUMN %s DROP NOT NULL", quoteExisting(column.Name)))
+		}
+	}
+
+	if len(destructive) > 0 && !allowDestructive {
+		return fmt.Errorf("Refuse to migrate %s: %s", tableName, strings.Join(destructive, ", "))
+	}
+	changes := append(safe, destructive...)
+	if len(changes) > 0 {
+		_, err = conn.Exec(fmt.Sprintf("ALTER TABLE %s %s", table, strings.Join(changes, ", ")))
+		if err != nil {
+			return err
+		}
+	}
+	return q.markExtra(conn, table, metas, columns)
+}
+
+// markExtra comments the extra columns of metas not marked yet
+func (q *QueryerImpl) markExtra(conn sqlx.Ext, table string, metas []*parser.SQLMeta, columns []*tableColumn) error {
+	marked := make(map[string]bool)
+	for _, column := range columns {
+		marked[column.Name] = column.Comment.String == extraComment
+	}
+	for _, meta := range metas {
+		if !meta.Extra || marked[meta.Name] {
+			continue
+		}
+		name, err := QuoteIdentifier(meta.Name)
+		if err != nil {
+			return err
+		}
+		_, err = conn.Exec(fmt.Sprintf("COMMENT ON COLUMN %s.%s IS '%s'", table, name, extraComment))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package database
+
+import (
+	"data_play/pkg/parser"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type SchemaTestSuite struct {
+	suite.Suite
+	sqlxDB  *sqlx.DB
+	mock    sqlmock.Sqlmock
+	queryer Queryer
+	metas   []*parser.SQLMeta
+}
+
+func (s *SchemaTestSuite) SetupTest() {
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		fmt.Println(err)
+	}
+	s.sqlxDB = sqlx.NewDb(mockDB, "sqlmock")
+	s.mock = mock
+	s.queryer = &QueryerImpl{}
+	s.metas = []*parser.SQLMeta{
+		&parser.SQLMeta{Name: "name", Size: 20, DataType: "TEXT"},
+		&parser.SQLMeta{Name: "count", Size: 8, DataType: "INTEGER"},
+		&parser.SQLMeta{Name: "amount", Size: 9, DataType: "DECIMAL", Scale: 2, Nullable: true},
+		&parser.SQLMeta{Name: "day", Size: 8, DataType: "DATE", Nullable: true},
+	}
+}
+
+func (s *SchemaTestSuite) TearDownTest() {
+	s.sqlxDB.Close()
+}
+
+func (s *SchemaTestSuite) expectColumns(rows *sqlmock.Rows) {
+	s.mock.ExpectQuery("^SELECT column_name, data_type, .* FROM information_schema.columns").
+		WithArgs("sample").
+		WillReturnRows(rows)
+}
+
+func columnRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{
+		"column_name", "data_type", "character_maximum_length", "numeric_precision", "numeric_scale", "is_nullable",
+	})
+}
+
+func (s *SchemaTestSuite) TestMigrateTableUpToDate() {
+	s.expectColumns(columnRows().
+		AddRow("name", "character varying", 20, nil, nil, "NO").
+		AddRow("count", "numeric", nil, 8, 0, "NO").
+		AddRow("amount", "numeric", nil, 9, 2, "YES").
+		AddRow("day", "date", nil, nil, nil, "YES"))
+	err := s.queryer.MigrateTable(s.sqlxDB, "sample", s.metas, false)
+	assert.Nil(s.T(), err)
+	assert.Nil(s.T(), s.mock.ExpectationsWereMet())
+}
+
+func (s *SchemaTestSuite) TestMigrateTableSafeChanges() {
+	s.expectColumns(columnRows().
+		AddRow("name", "character varying", 10, nil, nil, "NO").
+		AddRow("count", "numeric", nil, 5, 0, "NO").
+		AddRow("amount", "numeric", nil, 9, 2, "NO").
+		AddRow("old", "text", nil, nil, nil, "NO"))
+	s.mock.ExpectExec(`^ALTER TABLE "sample" ` +
+		`ALTER COLUMN "name" TYPE VARCHAR\(20\), ` +
+		`ALTER COLUMN "count" TYPE NUMERIC\(8\), ` +
+		`ALTER COLUMN "amount" DROP NOT NULL, ` +
+		`ADD COLUMN IF NOT EXISTS "day" DATE, ` +
+		`ALTER COLUMN "old" DROP NOT NULL$`).WillReturnResult(sqlmock.NewResult(0, 0))
+	err := s.queryer.MigrateTable(s.sqlxDB, "sample", s.metas, false)
+	assert.Nil(s.T(), err)
+	assert.Nil(s.T(), s.mock.ExpectationsWereMet())
+}
+
+func (s *SchemaTestSuite) TestMigrateTableRefuseDestructive() {
+	s.expectColumns(columnRows().
+		AddRow("name", "character varying", 30, nil, nil, "NO").
+		AddRow("count", "numeric", nil, 8, 0, "NO").
+		AddRow("amount", "numeric", nil, 9, 2, "YES").
+		AddRow("day", "text", nil, nil, nil, "YES"))
+	err := s.queryer.MigrateTable(s.sqlxDB, "sample", s.metas, false)
+	assert.Error(s.T(), err)
+	assert.Nil(s.T(), s.mock.ExpectationsWereMet())
+}
+
+func (s *SchemaTestSuite) TestMigrateTableAllowDestructive() {
+	s.expectColumns(columnRows().
+		AddRow("name", "character varying", 30, nil, nil, "NO").
+		AddRow("count", "numeric", nil, 8, 0, "NO").
+		AddRow("amount", "numeric", nil, 9, 2, "YES").
+		AddRow("day", "date", nil, nil, nil, "YES").
+		AddRow("old", "text", nil, nil, nil, "YES"))
+	s.mock.ExpectExec(`^ALTER TABLE "sample" ` +
+		`ALTER COLUMN "name" TYPE VARCHAR\(20\) USING "name"::VARCHAR\(20\), ` +
+		`DROP COLUMN "old"$`).WillReturnResult(sqlmock.NewResult(0, 0))
+	err := s.queryer.MigrateTable(s.sqlxDB, "sample", s.metas, true)
+	assert.Nil(s.T(), err)
+	assert.Nil(s.T(), s.mock.ExpectationsWereMet())
+}
+
+func (s *SchemaTestSuite) TestMigrateTableKeepExtra() {
+	metas := append(s.metas, &parser.SQLMeta{Name: "load_date", DataType: "DATE", Extra: true})
+	rows := sqlmock.NewRows([]string{
+		"column_name", "data_type", "character_maximum_length", "numeric_precision", "numeric_scale", "is_nullable", "column_comment",
+	}).
+		AddRow("name", "character varying", 20, nil, nil, "NO", nil).
+		AddRow("count", "numeric", nil, 8, 0, "NO", nil).
+		AddRow("amount", "numeric", nil, 9, 2, "YES", nil).
+		AddRow("day", "date", nil, nil, nil, "YES", nil).
+		AddRow("source_line", "bigint", nil, 64, 0, "NO", "dataplay extra column").
+		AddRow("old", "text", nil, nil, nil, "YES", nil)
+	s.expectColumns(rows)
+	// the lineage of an earlier load loses its NOT NULL, only old is dropped
+	s.mock.ExpectExec(`^ALTER TABLE "sample" ` +
+		`ADD COLUMN IF NOT EXISTS "load_date" DATE, ` +
+		`ALTER COLUMN "source_line" DROP NOT NULL, ` +
+		`DROP COLUMN "old"$`).WillReturnResult(sqlmock.NewResult(0, 0))
+	s.mock.ExpectExec(`^COMMENT ON COLUMN "sample"."load_date" IS 'dataplay extra column'$`).WillReturnResult(sqlmock.NewResult(0, 0))
+	err := s.queryer.MigrateTable(s.sqlxDB, "sample", metas, true)
+	assert.Nil(s.T(), err)
+	assert.Nil(s.T(), s.mock.ExpectationsWereMet())
+}
+
+func TestSchema(t *testing.T) {
+	suite.Run(t, new(SchemaTestSuite))
+}
+
+func TestColumnDefWidens(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(columnDef{kind: "VARCHAR", length: 5}.widens(columnDef{kind: "VARCHAR", length: 10}))
+	assert.True(columnDef{kind: "VARCHAR", length: 5}.widens(columnDef{kind: "TEXT"}))
+	assert.False(columnDef{kind: "TEXT"}.widens(columnDef{kind: "VARCHAR", length: 10}))
+	assert.True(columnDef{kind: "NUMERIC", precision: 5}.widens(columnDef{kind: "NUMERIC", precision: 8, scale: 2}))
+	assert.False(columnDef{kind: "NUMERIC", precision: 8, scale: 2}.widens(columnDef{kind: "NUMERIC", precision: 8, scale: 3}))
+	assert.False(columnDef{kind: "DATE"}.widens(columnDef{kind: "TIMESTAMP"}))
+}
@@ -7,14 +7,21 @@ import (
 	_ "github.com/lib/pq"
 )
 
+// DefaultMaxOpenConns is the connection pool size unless MaxOpenConns is set
+const DefaultMaxOpenConns = 4
+
 type PostgresDB struct {
+	// DSN is a full connection string, it wins over the fields below
+	DSN      string
 	Host     string
 	Port     string
 	Database string
 	Username string
 	Password string
 	Query    string
-	conn     *sqlx.DB
+	// MaxOpenConns bounds the connection pool, DefaultMaxOpenConns when unset
+	MaxOpenConns int
+	conn         *sqlx.DB
 }
 
 func (p *PostgresDB) Init() error {
@@ -28,11 +35,18 @@ func (p *PostgresDB) Init() error {
 		p.Database,
 		p.Query,
 	)
+	if p.DSN != "" {
+		URI = p.DSN
+	}
 	p.conn, err = sqlx.Connect("postgres", URI)
 	if err != nil {
 		return err
 	}
-	p.conn.SetMaxOpenConns(4)
+	maxOpenConns := p.MaxOpenConns
+	if maxOpenConns <= 0 {
+		maxOpenConns = DefaultMaxOpenConns
+	}
+	p.conn.SetMaxOpenConns(maxOpenConns)
 	return nil
 }
 
@@ -0,0 +1,82 @@
+package parser
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// benchmarkMetas is a ten column record of 80 bytes
+var benchmarkMetas = []*SQLMeta{
+	&SQLMeta{Name: "id", Size: 10, DataType: "BIGINT"},
+	&SQLMeta{Name: "name", Size: 20, DataType: "TEXT"},
+	&SQLMeta{Name: "active", Size: 1, DataType: "BOOLEAN"},
+	&SQLMeta{Name: "count", Size: 5, DataType: "INTEGER"},
+	&SQLMeta{Name: "amount", Size: 10, DataType: "DECIMAL", Scale: 2},
+	&SQLMeta{Name: "day", Size: 8, DataType: "DATE"},
+	&SQLMeta{Name: "ratio", Size: 6, DataType: "FLOAT"},
+	&SQLMeta{Name: "code", Size: 4, DataType: "TEXT"},
+	&SQLMeta{Name: "city", Size: 12, DataType: "TEXT"},
+	&SQLMeta{Name: "flag", Size: 4, DataType: "TEXT"},
+}
+
+func benchmarkData(lines int) string {
+	var builder strings.Builder
+	for i := 0; i < lines; i++ {
+		fmt.Fprintf(&builder, "%010d%-20s1%5d%10s20200329%6s%-4s%-12s%-4s\n", i, "Hello World", i%1000, "1234.56", "0.5", "AB", "Tokyo", "Y")
+	}
+	return builder.String()
+}
+
+func BenchmarkReadRow(b *testing.B) {
+	data := benchmarkData(10000)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		scanner := &DataScanner{
+			Metas:   benchmarkMetas,
+			Scanner: bufio.NewScanner(strings.NewReader(data)),
+		}
+		scanner.SetOptions(SpecOptions{})
+		for {
+			_, haveData, err := scanner.ReadRow()
+			if err != nil {
+				b.Fatal(err)
+			}
+			if !haveData {
+				break
+			}
+		}
+	}
+}
+
+// BenchmarkReadRowMap reads the same records into a map per row, as rows
+// were read before Row, the baseline of BenchmarkReadRow
+func BenchmarkReadRowMap(b *testing.B) {
+	data := benchmarkData(10000)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		scanner := &DataScanner{
+			Metas:   benchmarkMetas,
+			Scanner: bufio.NewScanner(strings.NewReader(data)),
+		}
+		scanner.SetOptions(SpecOptions{})
+		for scanner.Scanner.Scan() {
+			fields, err := scanner.fields(scanner.Scanner.Bytes(), benchmarkMetas)
+			if err != nil {
+				b.Fatal(err)
+			}
+			output := make(map[string]interface{})
+			for j, meta := range benchmarkMetas {
+				output[meta.Name], err = parseData(fields[j], meta)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"sync"
+)
+
+// MinChunkSize is the smallest byte range Split gives a scanner, a smaller
+// file is not worth more than one
+const MinChunkSize = 8 * 1024 * 1024
+
+// chunkReadSize is the block read looking for and counting line ends
+const chunkReadSize = 64 * 1024
+
+// Split cuts the data of ds into at most n byte ranges of at least minSize
+// bytes, aligned on records, each read by a scanner of its own so they can
+// be read at the same time. The first scanner is ds, the others share its
+// file and have nothing to close. Every scanner numbers the lines of the
+// whole file, so errors and rejects keep their line. Data that cannot be
+// cut, compressed, an archive member, delimited or of layouts, stays in ds
+// alone. Split must be called before the first ReadRow.
+func (ds *DataScanner) Split(n int, minSize int64) ([]*DataScanner, error) {
+	file := ds.plainFile()
+	if n < 2 || file == nil || ds.line > 0 || ds.Options.Format == FormatDelimited || len(ds.Layouts) > 0 {
+		return []*DataScanner{ds}, nil
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if minSize < 1 {
+		minSize = 1
+	}
+	if size/minSize < int64(n) {
+		n = int(size / minSize)
+	}
+	if n < 2 {
+		return []*DataScanner{ds}, nil
+	}
+
+	var bounds []int64
+	var lines []int
+	if ds.Options.RecordLength > 0 {
+		bounds, lines = recordBounds(size, ds.Options.RecordLength+ds.Options.RecordTerminator, n)
+	} else {
+		bounds, err = lineBounds(file, size, n, ds.source.lineEnds)
+		if err != nil {
+			return nil, err
+		}
+		lines, err = countLines(file, bounds, ds.source.lineEnds)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	scanners := make([]*DataScanner, 0, len(lines))
+	for i, line := range lines {
+		chunk := ds
+		if i > 0 {
+			chunk = &DataScanner{Metas: ds.Metas, Layouts: ds.Layouts}
+		}
+		chunk.Scanner = bufio.NewScanner(io.NewSectionReader(file, bounds[i], bounds[i+1]-bounds[i]))
+		chunk.line = line
+		if err = chunk.SetOptions(ds.Options); err != nil {
+			return nil, err
+		}
+		scanners = append(scanners, chunk)
+	}
+	return scanners, nil
+}
+
+// plainFile is the file of ds when its data are the bytes of the file
+func (ds *DataScanner) plainFile() *os.File {
+	if reader, ok := ds.file.(*dataReader); ok {
+		return reader.plain
+	}
+	return nil
+}
+
+// recordBounds cuts size bytes of records into n ranges, a partial record
+// at the end goes to the last range. lines are the records before every
+// range.
+func recordBounds(size int64, recordSize, n int) ([]int64, []int) {
+	records := size / int64(recordSize)
+	bounds := []int64{0}
+	lines := []int{0}
+	for i := 1; i < n; i++ {
+		record := records * int64(i) / int64(n)
+		if record > int64(lines[len(lines)-1]) {
+			bounds = append(bounds, record*int64(recordSize))
+			lines = append(lines, int(record))
+		}
+	}
+	return append(bounds, size), lines
+}
+
+// lineBounds cuts size bytes of lines into at most n ranges, every range
+// but the first starts after a line end
+func lineBounds(file io.ReaderAt, size int64, n int, lineEnds []byte) ([]int64, error) {
+	bounds := []int64{0}
+	for i := 1; i < n; i++ {
+		from := size * int64(i) / int64(n)
+		if from <= bounds[len(bounds)-1] {
+			continue
+		}
+		bound, err := nextLine(file, from, size, lineEnds)
+		if err != nil {
+			return nil, err
+		}
+		if bound >= size {
+			break
+		}
+		if bound > bounds[len(bounds)-1] {
+			bounds = append(bounds, bound)
+		}
+	}
+	return append(bounds, size), nil
+}
+
+// nextLine is the offset of the first line starting at or after from
+func nextLine(file io.ReaderAt, from, size int64, lineEnds []byte) (int64, error) {
+	buffer := make([]byte, chunkReadSize)
+	// a line end just before from starts a line at from
+	offset := from - 1
+	for offset < size {
+		read, err := file.ReadAt(buffer, offset)
+		if i := bytes.IndexAny(buffer[:read], string(lineEnds)); i >= 0 {
+			return offset + int64(i) + 1, nil
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		offset += int64(read)
+	}
+	return size, nil
+}
+
+// countLines returns the lines before every range of bounds, counting the
+// line ends of the ranges at the same time
+func countLines(file io.ReaderAt, bounds []int64, lineEnds []byte) ([]int, error) {
+	counts := make([]int, len(bounds)-1)
+	errs := make([]error, len(bounds)-1)
+	var wg sync.WaitGroup
+	// the last range has no range after it to count for
+	for i := 0; i < len(counts)-1; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			counts[i], errs[i] = countLineEnds(io.NewSectionReader(file, bounds[i], bounds[i+1]-bounds[i]), lineEnds)
+		}(i)
+	}
+	wg.Wait()
+
+	lines := make([]int, len(counts))
+	for i := range counts {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		if i > 0 {
+			lines[i] = lines[i-1] + counts[i-1]
+		}
+	}
+	return lines, nil
+}
+
+func countLineEnds(reader io.Reader, lineEnds []byte) (int, error) {
+	buffer := make([]byte, chunkReadSize)
+	count := 0
+	for {
+		read, err := reader.Read(buffer)
+		for _, lineEnd := range lineEnds {
+			count += bytes.Count(buffer[:read], []byte{lineEnd})
+		}
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+	}
+}
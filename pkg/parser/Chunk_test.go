@@ -0,0 +1,144 @@
+package parser
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/encoding/charmap"
+)
+
+var chunkMetas = []*SQLMeta{
+	&SQLMeta{Name: "name", Size: 10, DataType: "TEXT"},
+	&SQLMeta{Name: "active", Size: 1, DataType: "BOOLEAN"},
+	&SQLMeta{Name: "count", Size: 5, DataType: "INTEGER"},
+}
+
+// chunkData is lines of 16 bytes, the bad line is too short
+func chunkData(lines, bad int, lineEnd string) string {
+	var builder strings.Builder
+	for i := 1; i <= lines; i++ {
+		if i == bad {
+			builder.WriteString("bad" + lineEnd)
+			continue
+		}
+		fmt.Fprintf(&builder, "%-10s1%5d%s", fmt.Sprintf("row%d", i), i, lineEnd)
+	}
+	return builder.String()
+}
+
+func writeChunkData(data []byte) string {
+	file, _ := ioutil.TempFile("", "TestSplit*.txt")
+	file.Write(data)
+	file.Close()
+	return file.Name()
+}
+
+// readChunks reads every scanner and returns the count or the error of
+// every line
+func readChunks(t *testing.T, scanners []*DataScanner) map[int]interface{} {
+	read := make(map[int]interface{})
+	for _, scanner := range scanners {
+		for {
+			row, haveData, err := scanner.ReadRow()
+			if !haveData {
+				assert.Nil(t, err)
+				break
+			}
+			if err != nil {
+				read[scanner.Line()] = err.Error()
+				continue
+			}
+			count, _ := row.Get("count")
+			read[scanner.Line()] = count
+		}
+	}
+	return read
+}
+
+func TestSplitLines(t *testing.T) {
+	assert := assert.New(t)
+	path := writeChunkData([]byte(chunkData(50, 17, "\r\n")))
+	defer os.Remove(path)
+	p := NewDataParser(chunkMetas)
+
+	scanner, _ := p.Parse(path)
+	expected := readChunks(t, []*DataScanner{scanner})
+	scanner.Close()
+	assert.Len(expected, 50)
+	assert.Equal("not enough length of data", expected[17])
+
+	for _, n := range []int{2, 3, 7, 50, 100} {
+		scanner, _ = p.Parse(path)
+		scanners, err := scanner.Split(n, 1)
+		assert.Nil(err)
+		assert.True(len(scanners) > 1 && len(scanners) <= n)
+		assert.Same(scanner, scanners[0])
+		assert.Equal(expected, readChunks(t, scanners), "split in %d", n)
+		scanner.Close()
+	}
+}
+
+func TestSplitRecords(t *testing.T) {
+	assert := assert.New(t)
+	path := writeChunkData([]byte(chunkData(20, 0, "\r\n")))
+	defer os.Remove(path)
+	p := &DataParserImpl{Metas: chunkMetas, Options: SpecOptions{RecordLength: 16, RecordTerminator: 2, WidthUnit: WidthBytes}}
+
+	scanner, _ := p.Parse(path)
+	defer scanner.Close()
+	scanners, err := scanner.Split(3, 1)
+	assert.Nil(err)
+	assert.Len(scanners, 3)
+	read := readChunks(t, scanners)
+	assert.Len(read, 20)
+	for line, count := range read {
+		assert.Equal(line, count)
+	}
+}
+
+func TestSplitEBCDIC(t *testing.T) {
+	assert := assert.New(t)
+	data, _ := charmap.CodePage037.NewEncoder().String(chunkData(10, 0, "\u0085"))
+	path := writeChunkData([]byte(data))
+	defer os.Remove(path)
+	p := &DataParserImpl{Metas: chunkMetas, Options: SpecOptions{Encoding: EncodingEBCDIC}}
+
+	scanner, _ := p.Parse(path)
+	defer scanner.Close()
+	scanners, err := scanner.Split(4, 1)
+	assert.Nil(err)
+	assert.Len(scanners, 4)
+	read := readChunks(t, scanners)
+	assert.Len(read, 10)
+	for line, count := range read {
+		assert.Equal(line, count)
+	}
+}
+
+func TestSplitNotSplittable(t *testing.T) {
+	assert := assert.New(t)
+	data := chunkData(10, 0, "\n")
+	path := writeChunkData([]byte(data))
+	defer os.Remove(path)
+	compressed := writeChunkData(gzipData(data))
+	defer os.Remove(compressed)
+	p := NewDataParser(chunkMetas)
+
+	// smaller than the min size
+	scanner, _ := p.Parse(path)
+	scanners, err := scanner.Split(4, int64(len(data)))
+	assert.Nil(err)
+	assert.Equal([]*DataScanner{scanner}, scanners)
+	scanner.Close()
+
+	scanner, _ = p.Parse(compressed)
+	scanners, err = scanner.Split(4, 1)
+	assert.Nil(err)
+	assert.Equal([]*DataScanner{scanner}, scanners)
+	assert.Len(readChunks(t, scanners), 10)
+	scanner.Close()
+}
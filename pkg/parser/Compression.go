@@ -0,0 +1,221 @@
+package parser
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// MemberSeparator addresses a member of a zip archive as a data file, like
+// data/bundle.zip!/sample_1.txt
+const MemberSeparator = "!/"
+
+// extensions of the compressed data files and of the archives
+const (
+	ExtGzip    = ".gz"
+	ExtBzip2   = ".bz2"
+	ExtZstd    = ".zst"
+	ExtArchive = ".zip"
+)
+
+var (
+	magicGzip    = []byte{0x1f, 0x8b}
+	magicBzip2   = []byte("BZh")
+	magicZstd    = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	magicArchive = []byte("PK\x03\x04")
+)
+
+var compressionExts = []string{ExtGzip, ExtBzip2, ExtZstd}
+
+// dataReader closes the decompressor and the file under it
+type dataReader struct {
+	io.Reader
+	closers []io.Closer
+	// plain is the file when the data is its bytes as they are, neither
+	// compressed nor an archive member
+	plain      *os.File
+	compressed bool
+}
+
+func (r *dataReader) Close() error {
+	var err error
+	for i := len(r.closers) - 1; i >= 0; i-- {
+		if closeErr := r.closers[i].Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// OpenData opens a data file or a member of a zip archive and decompresses
+// gzip, bzip2 or zstd content, told by its magic bytes
+func OpenData(filePath string) (io.ReadCloser, error) {
+	reader := &dataReader{}
+	name := filePath
+	if archive, member, ok := SplitMember(filePath); ok {
+		zipReader, err := zip.OpenReader(archive)
+		if err != nil {
+			return nil, fmt.Errorf("Fail to open archive %s, %v", archive, err)
+		}
+		reader.closers = append(reader.closers, zipReader)
+		file, err := openMember(&zipReader.Reader, member)
+		if err != nil {
+			reader.Close()
+			return nil, fmt.Errorf("Fail to open %s, %v", filePath, err)
+		}
+		reader.closers = append(reader.closers, file)
+		reader.Reader = file
+		name = member
+	} else {
+		file, err := os.Open(filePath)
+		if err != nil {
+			return nil, err
+		}
+		reader.closers = append(reader.closers, file)
+		reader.Reader = file
+	}
+	err := reader.decompress(name)
+	if err != nil {
+		reader.Close()
+		return nil, fmt.Errorf("Fail to read %s, %v", filePath, err)
+	}
+	if file, ok := reader.closers[0].(*os.File); ok && !reader.compressed {
+		reader.plain = file
+	}
+	return reader, nil
+}
+
+// decompress reads the content under the compression of its magic bytes,
+// a compressed extension without them is an error
+func (r *dataReader) decompress(name string) error {
+	buffered := bufio.NewReader(r.Reader)
+	r.Reader = buffered
+	magic, _ := buffered.Peek(len(magicZstd))
+	switch {
+	case bytes.HasPrefix(magic, magicGzip):
+		gzipReader, err := gzip.NewReader(buffered)
+		if err != nil {
+			return err
+		}
+		r.closers = append(r.closers, gzipReader)
+		r.Reader = gzipReader
+	case bytes.HasPrefix(magic, magicBzip2):
+		r.Reader = bzip2.NewReader(buffered)
+	case bytes.HasPrefix(magic, magicZstd):
+		zstdReader, err := zstd.NewReader(buffered)
+		if err != nil {
+			return err
+		}
+		r.closers = append(r.closers, closerFunc(func() error {
+			zstdReader.Close()
+			return nil
+		}))
+		r.Reader = zstdReader
+	default:
+		if ext := compressionExt(name); ext != "" {
+			return fmt.Errorf("no %s magic bytes", ext)
+		}
+		return nil
+	}
+	r.compressed = true
+	return nil
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
+
+func openMember(archive *zip.Reader, member string) (io.ReadCloser, error) {
+	for _, file := range archive.File {
+		if file.Name == member {
+			return file.Open()
+		}
+	}
+	return nil, fmt.Errorf("no member %s", member)
+}
+
+// SplitMember splits the path of an archive member into the archive and
+// the member name, ok is false for a plain file
+func SplitMember(filePath string) (string, string, bool) {
+	i := strings.Index(filePath, MemberSeparator)
+	if i < 0 {
+		return "", "", false
+	}
+	return filePath[:i], filePath[i+len(MemberSeparator):], true
+}
+
+// IsArchive tells a zip archive by its extension or its magic bytes
+func IsArchive(filePath string) bool {
+	if strings.EqualFold(filepath.Ext(filePath), ExtArchive) {
+		return true
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	magic := make([]byte, len(magicArchive))
+	_, err = io.ReadFull(file, magic)
+	return err == nil && bytes.Equal(magic, magicArchive)
+}
+
+// ArchiveMembers returns the data files of a zip archive whose base name
+// matches the glob pattern, compressed or not, every one to load on its own
+func ArchiveMembers(archive, pattern string) ([]string, error) {
+	zipReader, err := zip.OpenReader(archive)
+	if err != nil {
+		return nil, fmt.Errorf("Fail to open archive %s, %v", archive, err)
+	}
+	defer zipReader.Close()
+	var members []string
+	for _, file := range zipReader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		matched, err := path.Match(pattern, TrimCompression(path.Base(file.Name)))
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			members = append(members, archive+MemberSeparator+file.Name)
+		}
+	}
+	return members, nil
+}
+
+// InputGlobs are the globs of the files of an input glob: itself, its
+// compressed files and the archives next to them
+func InputGlobs(pattern string) []string {
+	globs := []string{pattern}
+	for _, ext := range compressionExts {
+		globs = append(globs, pattern+ext)
+	}
+	return append(globs, filepath.Join(filepath.Dir(pattern), "*"+ExtArchive))
+}
+
+// TrimCompression is the name of a data file without its compressed
+// extension, sample_1.txt for sample_1.txt.gz
+func TrimCompression(name string) string {
+	return strings.TrimSuffix(name, compressionExt(name))
+}
+
+func compressionExt(name string) string {
+	for _, ext := range compressionExts {
+		if strings.EqualFold(filepath.Ext(name), ext) {
+			return filepath.Ext(name)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,142 @@
+package parser
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+const testCompressedData = "Hello World     true 123\n"
+
+// bzip2 of testCompressedData, the standard library only reads bzip2
+var testBzip2Data = []byte{66, 90, 104, 57, 49, 65, 89, 38, 83, 89, 129, 164, 91, 100, 0, 0, 5, 223, 128, 32, 16, 64, 0, 56, 0, 0, 64, 0, 128, 6, 4, 150, 0, 32, 0, 49, 76, 0, 1, 77, 49, 30, 147, 212, 218, 154, 150, 200, 162, 252, 1, 202, 55, 81, 139, 234, 91, 248, 187, 146, 41, 194, 132, 132, 13, 34, 219, 32}
+
+func gzipData(data string) []byte {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	writer.Write([]byte(data))
+	writer.Close()
+	return buffer.Bytes()
+}
+
+func zstdData(data string) []byte {
+	var buffer bytes.Buffer
+	writer, _ := zstd.NewWriter(&buffer)
+	writer.Write([]byte(data))
+	writer.Close()
+	return buffer.Bytes()
+}
+
+func writeArchive(path string, members map[string][]byte) {
+	file, _ := os.Create(path)
+	defer file.Close()
+	writer := zip.NewWriter(file)
+	for name, data := range members {
+		member, _ := writer.Create(name)
+		member.Write(data)
+	}
+	writer.Close()
+}
+
+func readData(filePath string) (string, error) {
+	reader, err := OpenData(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	return string(data), err
+}
+
+func TestOpenDataCompressed(t *testing.T) {
+	assert := assert.New(t)
+	dir, _ := ioutil.TempDir("", "TestOpenDataCompressed")
+	defer os.RemoveAll(dir)
+	files := map[string][]byte{
+		"sample_1.txt":     []byte(testCompressedData),
+		"sample_1.txt.gz":  gzipData(testCompressedData),
+		"sample_1.txt.bz2": testBzip2Data,
+		"sample_1.txt.zst": zstdData(testCompressedData),
+		// told by the magic bytes whatever the extension
+		"sample_2.txt": gzipData(testCompressedData),
+	}
+	for name, data := range files {
+		ioutil.WriteFile(filepath.Join(dir, name), data, 0644)
+		read, err := readData(filepath.Join(dir, name))
+		assert.Nil(err, name)
+		assert.Equal(testCompressedData, read, name)
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "sample_3.txt.gz"), []byte(testCompressedData), 0644)
+	_, err := readData(filepath.Join(dir, "sample_3.txt.gz"))
+	assert.Error(err)
+}
+
+func TestOpenDataArchive(t *testing.T) {
+	assert := assert.New(t)
+	dir, _ := ioutil.TempDir("", "TestOpenDataArchive")
+	defer os.RemoveAll(dir)
+	archive := filepath.Join(dir, "bundle.zip")
+	writeArchive(archive, map[string][]byte{
+		"sample_1.txt":           []byte(testCompressedData),
+		"nested/sample_2.txt.gz": gzipData(testCompressedData),
+		"readme.md":              []byte("# bundle"),
+	})
+
+	members, err := ArchiveMembers(archive, "*.txt")
+	assert.Nil(err)
+	assert.ElementsMatch([]string{archive + "!/sample_1.txt", archive + "!/nested/sample_2.txt.gz"}, members)
+	for _, member := range members {
+		read, err := readData(member)
+		assert.Nil(err, member)
+		assert.Equal(testCompressedData, read, member)
+	}
+	assert.True(IsArchive(archive))
+	assert.False(IsArchive(members[0]))
+
+	_, err = readData(archive + "!/missing.txt")
+	assert.Error(err)
+	_, err = ArchiveMembers(filepath.Join(dir, "missing.zip"), "*")
+	assert.Error(err)
+}
+
+func TestParseCompressed(t *testing.T) {
+	assert := assert.New(t)
+	file, _ := ioutil.TempFile("", "TestParseCompressed*.txt.gz")
+	file.Write(gzipData(testCompressedData))
+	file.Close()
+	defer os.Remove(file.Name())
+
+	p := NewDataParser([]*SQLMeta{
+		&SQLMeta{Name: "name", Size: 16, DataType: "TEXT"},
+		&SQLMeta{Name: "active", Size: 4, DataType: "BOOLEAN"},
+		&SQLMeta{Name: "count", Size: 4, DataType: "INTEGER"},
+	})
+	scanner, err := p.Parse(file.Name())
+	assert.Nil(err)
+	defer scanner.Close()
+	row, haveData, err := scanner.ReadRow()
+	assert.True(haveData)
+	assert.Nil(err)
+	assert.Equal(map[string]interface{}{"name": "Hello World", "active": true, "count": 123}, row.Map())
+}
+
+func TestInputGlobs(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]string{
+		filepath.Join("data", "*.txt"),
+		filepath.Join("data", "*.txt.gz"),
+		filepath.Join("data", "*.txt.bz2"),
+		filepath.Join("data", "*.txt.zst"),
+		filepath.Join("data", "*.zip"),
+	}, InputGlobs(filepath.Join("data", "*.txt")))
+	assert.Equal("sample_1.txt", TrimCompression("sample_1.txt.GZ"))
+	assert.Equal("sample_1.txt", TrimCompression("sample_1.txt"))
+}
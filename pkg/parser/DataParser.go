@@ -3,24 +3,51 @@ package parser
 import (
 	"bufio"
 	"fmt"
-	"os"
+	"io"
 	"strconv"
 	"strings"
+	"time"
 )
 
+// DefaultMaxRecordLength is the longest line or record read unless the spec
+// or the job says otherwise, bufio.Scanner alone stops at 64KB
+const DefaultMaxRecordLength = 1024 * 1024
+
+// startBufferSize is the first buffer of a scanner, grown up to the max
+const startBufferSize = 4096
+
+// lineEndSize leaves room for a CRLF after a line of the max record length
+const lineEndSize = 2
+
 type DataParser interface {
 	Parse(filePath string) (*DataScanner, error)
 	Meta() []*SQLMeta
+	// Layouts are the record types of a spec of layouts, nil otherwise
+	Layouts() []*Layout
+	Version() string
 }
 
 type DataParserImpl struct {
-	Metas []*SQLMeta
+	Metas       []*SQLMeta
+	Options     SpecOptions
+	SpecVersion string
+	layouts     []*Layout
 }
 
 type DataScanner struct {
-	Metas   []*SQLMeta
-	file    *os.File
+	Metas []*SQLMeta
+	// Layouts read every record with the metas of its record type
+	Layouts []*Layout
+	Options SpecOptions
+	file    io.ReadCloser
 	Scanner *bufio.Scanner
+	line    int
+	source  *sourceEncoding
+	layout  *Layout
+	details int
+	trailer bool
+	// delimited reads a delimited file instead of Scanner
+	delimited *delimitedReader
 }
 
 func NewDataParser(metas []*SQLMeta) DataParser {
@@ -30,63 +57,299 @@ func NewDataParser(metas []*SQLMeta) DataParser {
 }
 
 func (dp *DataParserImpl) Parse(filePath string) (*DataScanner, error) {
-	var file *os.File
-	var err error
-	file, err = os.Open(filePath)
+	file, err := OpenData(filePath)
 	if err != nil {
 		return nil, err
 	}
 
-	return &DataScanner{
+	scanner := &DataScanner{
 		Metas:   dp.Metas,
+		Layouts: dp.layouts,
+		Options: dp.Options,
 		file:    file,
 		Scanner: bufio.NewScanner(file),
-	}, nil
+	}
+	err = scanner.SetOptions(dp.Options)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return scanner, nil
 }
 
 func (dp *DataParserImpl) Meta() []*SQLMeta {
 	return dp.Metas
 }
 
-func (ds *DataScanner) ReadRow() (*map[string]interface{}, bool, error) {
-	var output = make(map[string]interface{})
+func (dp *DataParserImpl) Layouts() []*Layout {
+	return dp.layouts
+}
+
+func (dp *DataParserImpl) Version() string {
+	return dp.SpecVersion
+}
+
+// ReadRow returns the next row, haveData is false at the end of the data or
+// on an error that fails the whole file, otherwise err is a bad row
+func (ds *DataScanner) ReadRow() (*Row, bool, error) {
+	if ds.Options.Format == FormatDelimited {
+		return ds.readDelimited()
+	}
 	hasData := ds.Scanner.Scan()
 	if !hasData {
-		return nil, hasData, nil
+		if err := ds.Scanner.Err(); err != nil {
+			return nil, false, ds.scanError(err)
+		}
+		return nil, false, ds.checkEnd()
 	}
-	if err := ds.Scanner.Err(); err != nil {
-		return nil, false, err
+	raw := ds.Scanner.Bytes()
+	if len(raw) > ds.Options.maxRecordLength() {
+		return nil, false, ds.scanError(bufio.ErrTooLong)
 	}
+	ds.line++
 
-	row := ds.Scanner.Text()
-	remain := []rune(row)
-	for _, meta := range ds.Metas {
-		if len(remain) < meta.Size {
-			return nil, true, fmt.Errorf("not enough length of data")
+	metas := ds.Metas
+	if len(ds.Layouts) > 0 {
+		var err error
+		ds.layout, err = ds.readLayout(raw)
+		if _, ok := err.(errRecord); ok {
+			return nil, false, err
 		}
-		raw := remain[0:meta.Size]
-		datum, err := parseData(string(raw), meta.DataType)
 		if err != nil {
 			return nil, true, err
 		}
-		output[meta.Name] = datum
-		remain = remain[meta.Size:]
+		metas = ds.layout.Metas
+	}
+	row := NewRow(metas)
+	err := ds.readFields(raw, row)
+	if ds.layout != nil && ds.layout.Code == ds.Options.Trailer {
+		// a bad trailer is a bad file, not a bad row
+		if err == nil {
+			err = ds.checkTrailer(row)
+		}
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	if err != nil {
+		return nil, true, err
+	}
+	if ds.layout != nil && ds.layout.Code != ds.Options.Header && ds.layout.Code != ds.Options.Trailer {
+		// the trailer count is of the detail rows loaded, not the rejects
+		ds.details++
+	}
+	return row, true, nil
+}
+
+func (ds *DataScanner) readFields(raw []byte, row *Row) error {
+	fields, err := ds.fields(raw, row.Metas)
+	if err != nil {
+		return err
+	}
+	for i, meta := range row.Metas {
+		row.Values[i], err = parseData(fields[i], meta)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Layout is the record type of the last row read, nil without layouts
+func (ds *DataScanner) Layout() *Layout {
+	return ds.layout
+}
+
+// SetOptions reads the data with options, it must be called before the
+// first ReadRow
+func (ds *DataScanner) SetOptions(options SpecOptions) error {
+	source, err := lookupEncoding(options.Encoding)
+	if err != nil {
+		return err
+	}
+	if err = options.checkRecordUnit(source); err != nil {
+		return err
+	}
+	ds.Options = options
+	ds.source = source
+	if ds.Scanner == nil {
+		return nil
+	}
+	if options.RecordLength > 0 {
+		ds.Scanner.Split(scanRecords(options.RecordLength, options.RecordTerminator, source.lineEnds))
+	} else {
+		ds.Scanner.Split(source.split)
+	}
+	ds.Scanner.Buffer(newScanBuffer(options))
+	return nil
+}
+
+// newScanBuffer is the buffer and the max token size of a bufio.Scanner
+// reading records of options
+func newScanBuffer(options SpecOptions) ([]byte, int) {
+	max := options.maxRecordLength() + lineEndSize
+	return make([]byte, 0, minInt(startBufferSize, max)), max
+}
+
+// SetMaxRecordLength reads lines or records up to length bytes, it
+// overrides the spec and must be called before the first ReadRow
+func (ds *DataScanner) SetMaxRecordLength(length int) error {
+	if length < 1 {
+		return fmt.Errorf("invalid max record length %d", length)
+	}
+	options := ds.Options
+	options.MaxRecordLength = length
+	return ds.SetOptions(options)
+}
+
+// scanError tells which line is too long rather than the bare
+// bufio.ErrTooLong
+func (ds *DataScanner) scanError(err error) error {
+	if err == bufio.ErrTooLong {
+		return fmt.Errorf("Fail to read line %d, longer than the max record length of %d bytes", ds.line+1, ds.Options.maxRecordLength())
+	}
+	return fmt.Errorf("Fail to read line %d, %v", ds.line+1, err)
+}
+
+// maxRecordLength is MaxRecordLength or its default, at least a record
+// with its terminator
+func (o SpecOptions) maxRecordLength() int {
+	max := o.MaxRecordLength
+	if max <= 0 {
+		max = DefaultMaxRecordLength
+	}
+	if o.RecordLength+o.RecordTerminator > max {
+		max = o.RecordLength + o.RecordTerminator
+	}
+	return max
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// SetEncoding decodes the data from the named encoding, it overrides the
+// encoding of the spec and must be called before the first ReadRow
+func (ds *DataScanner) SetEncoding(name string) error {
+	options := ds.Options
+	options.Encoding = name
+	return ds.SetOptions(options)
+}
+
+// fields cuts a raw line into its decoded fields. Byte widths count the
+// bytes of the source encoding, so the line is cut before being decoded.
+func (ds *DataScanner) fields(raw []byte, metas []*SQLMeta) ([]string, error) {
+	if ds.Options.WidthUnit != WidthBytes {
+		row, err := ds.source.decode(raw)
+		if err != nil {
+			return nil, err
+		}
+		return splitFields(row, metas, ds.Options.WidthUnit)
 	}
-	return &output, true, nil
+	fields, err := splitFields(string(raw), metas, WidthBytes)
+	if err != nil {
+		return nil, err
+	}
+	for i, field := range fields {
+		fields[i], err = ds.source.decode([]byte(field))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fields, nil
+}
+
+// Line is the number of the last line read, starting from 1
+func (ds *DataScanner) Line() int {
+	return ds.line
+}
+
+// Text is the content of the last line read, decoded when it can be
+func (ds *DataScanner) Text() string {
+	if ds.delimited != nil {
+		return strings.Join(ds.delimited.record, ds.delimited.delimiter)
+	}
+	text, err := ds.source.decode(ds.Scanner.Bytes())
+	if err != nil {
+		return ds.Scanner.Text()
+	}
+	return text
 }
 
 func (ds *DataScanner) Close() {
-	ds.file.Close()
+	if ds.file != nil {
+		ds.file.Close()
+	}
+}
+
+// ParseValue reads datum the way a field of the meta column is read
+func ParseValue(datum string, meta *SQLMeta) (interface{}, error) {
+	return parseData(datum, meta)
 }
 
-// assuming datatype only consist of INTEGER, BOOLEAN, TEXT
-func parseData(datum, dataType string) (interface{}, error) {
-	switch dataType {
+// unknown datatype are read as TEXT
+func parseData(datum string, meta *SQLMeta) (interface{}, error) {
+	var err error
+	if meta.Nullable && isNull(datum, meta.NullValues) {
+		return nil, nil
+	}
+	switch meta.DataType {
+	case "INTEGER", "BIGINT", "FLOAT", "DECIMAL":
+		datum, err = decodeSign(datum, meta.Sign)
+		if err != nil {
+			return nil, err
+		}
+	}
+	switch meta.DataType {
 	case "INTEGER":
 		return strconv.Atoi(strings.TrimSpace(datum))
+	case "BIGINT":
+		return strconv.ParseInt(strings.TrimSpace(datum), 10, 64)
+	case "FLOAT":
+		return strconv.ParseFloat(strings.TrimSpace(datum), 64)
+	case "DECIMAL":
+		if meta.Implied {
+			return parseImplied(datum, meta.Scale)
+		}
+		return ParseDecimal(datum, meta.Scale)
 	case "BOOLEAN":
 		return strconv.ParseBool(datum)
+	case "DATE":
+		return parseTime(datum, meta.Format, DefaultDateFormat)
+	case "TIMESTAMP":
+		return parseTime(datum, meta.Format, DefaultTimestampFormat)
 	case "TEXT":
 	}
 	return strings.TrimSpace(datum), nil
 }
+
+func isNull(datum string, nullValues []string) bool {
+	trimmed := strings.TrimSpace(datum)
+	for _, null := range nullValues {
+		switch null {
+		case NullSpaces:
+			if trimmed == "" {
+				return true
+			}
+		case NullZeros:
+			if trimmed != "" && strings.Trim(trimmed, "0") == "" {
+				return true
+			}
+		default:
+			if trimmed == null {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func parseTime(datum, format, defaultFormat string) (time.Time, error) {
+	if format == "" {
+		format = defaultFormat
+	}
+	return time.Parse(format, strings.TrimSpace(datum))
+}
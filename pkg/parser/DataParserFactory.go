@@ -1,12 +1,20 @@
 package parser
 
-import "sync"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
 
 type DataParserFactory interface {
 	MakeParser(modelName string) (DataParser, error)
 }
 
-var singleton *DataParserFactoryImpl = nil
+// one factory per spec dir, so every worker shares the parsed specs
+var singletons = &sync.Map{}
 
 type DataParserFactoryImpl struct {
 	SpecDir string
@@ -14,33 +22,136 @@ type DataParserFactoryImpl struct {
 }
 
 func NewDataParserFactory(specDir string) DataParserFactory {
-	if singleton != nil {
-		return singleton
-	}
-	singleton = &DataParserFactoryImpl{
+	factory, _ := singletons.LoadOrStore(specDir, &DataParserFactoryImpl{
 		SpecDir: specDir,
 		Cache:   &sync.Map{},
-	}
-	return singleton
+	})
+	return factory.(*DataParserFactoryImpl)
 }
 
 func (dpf *DataParserFactoryImpl) MakeParser(modelName string) (DataParser, error) {
-	var err error
-	if parser, ok := dpf.Cache.Load(modelName); ok {
-		return parser.(DataParser), nil
+	return dpf.makeParser(modelName, true)
+}
+
+// cachedParser is a parser with the state of its spec files when they
+// were read, a spec of layouts also has the specs of its layouts
+type cachedParser struct {
+	parser DataParser
+	specs  []specState
+}
+
+type specState struct {
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+func readSpecState(path string) (specState, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return specState{}, err
+	}
+	return specState{path: path, modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+// changed is true when a spec file was edited or removed since it was read,
+// so a long running watch picks up the edited specs
+func (c *cachedParser) changed() bool {
+	for _, spec := range c.specs {
+		state, err := readSpecState(spec.path)
+		if err != nil || state != spec {
+			return true
+		}
+	}
+	return false
+}
+
+// makeParser reads the spec of modelName, a spec of layouts is refused
+// unless withLayouts
+func (dpf *DataParserFactoryImpl) makeParser(modelName string, withLayouts bool) (DataParser, error) {
+	cached, err := dpf.cachedParser(modelName, withLayouts)
+	if err != nil {
+		return nil, err
+	}
+	return cached.parser, nil
+}
+
+// cachedParser returns the parser of modelName from the cache, read again
+// when one of its spec files changed
+func (dpf *DataParserFactoryImpl) cachedParser(modelName string, withLayouts bool) (*cachedParser, error) {
+	if value, ok := dpf.Cache.Load(modelName); ok && !value.(*cachedParser).changed() {
+		cached := value.(*cachedParser)
+		if !withLayouts && len(cached.parser.Layouts()) > 0 {
+			return nil, fmt.Errorf("Spec %s has layouts", modelName)
+		}
+		return cached, nil
 	}
 	specFile := dpf.SpecDir + modelName + ".csv"
-	var meta []*SQLMeta
-	var sqlparser *SQLMetaCSVParser
-	sqlparser, err = NewSQLMetaCSVParser(specFile)
+	// the state is taken before reading, an edit while reading is seen on
+	// the next call
+	state, err := readSpecState(specFile)
 	if err != nil {
 		return nil, err
 	}
-	meta, err = sqlparser.Parse()
+	sqlparser, err := NewSQLMetaCSVParser(specFile)
 	if err != nil {
 		return nil, err
 	}
-	p := NewDataParser(meta)
-	dpf.Cache.Store(modelName, p)
-	return p, nil
+	meta, err := sqlparser.Parse()
+	if err != nil {
+		return nil, err
+	}
+	cached := &cachedParser{specs: []specState{state}}
+	if sqlparser.Options().Format == FormatDelimited {
+		cached.parser = &DelimitedParser{
+			Metas:       meta,
+			Options:     sqlparser.Options(),
+			SpecVersion: sqlparser.Version(),
+		}
+		dpf.Cache.Store(modelName, cached)
+		return cached, nil
+	}
+	p := &DataParserImpl{
+		Metas:       meta,
+		Options:     sqlparser.Options(),
+		SpecVersion: sqlparser.Version(),
+	}
+	if len(p.Options.Layouts) > 0 {
+		if !withLayouts {
+			return nil, fmt.Errorf("Spec %s has layouts", modelName)
+		}
+		err = dpf.makeLayouts(modelName, p, cached)
+		if err != nil {
+			return nil, err
+		}
+	}
+	cached.parser = p
+	dpf.Cache.Store(modelName, cached)
+	return cached, nil
+}
+
+// makeLayouts reads the spec of every layout of p, the version of p then
+// changes with any of them
+func (dpf *DataParserFactoryImpl) makeLayouts(modelName string, p *DataParserImpl, cached *cachedParser) error {
+	hash := sha256.New()
+	hash.Write([]byte(p.SpecVersion))
+	for _, option := range p.Options.Layouts {
+		layoutParser, err := dpf.cachedParser(option.Model, false)
+		if err != nil {
+			return fmt.Errorf("Fail to read layout %s of %s, %v", option.Code, modelName, err)
+		}
+		p.layouts = append(p.layouts, &Layout{
+			Code:  option.Code,
+			Model: option.Model,
+			Metas: layoutParser.parser.Meta(),
+		})
+		hash.Write([]byte(layoutParser.parser.Version()))
+		cached.specs = append(cached.specs, layoutParser.specs...)
+	}
+	err := checkTrailerCount(p.Options, p.layouts)
+	if err != nil {
+		return fmt.Errorf("Fail to read layouts of %s, %v", modelName, err)
+	}
+	p.SpecVersion = hex.EncodeToString(hash.Sum(nil))
+	return nil
 }
@@ -0,0 +1,55 @@
+package parser
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeSpec writes a spec with a modification time of its own, as an edit
+// a while after the last one
+func writeSpec(dir, name, spec string, modTime time.Time) {
+	path := filepath.Join(dir, name)
+	ioutil.WriteFile(path, []byte(spec), 0644)
+	os.Chtimes(path, modTime, modTime)
+}
+
+func TestMakeParserReload(t *testing.T) {
+	assert := assert.New(t)
+	dir, _ := ioutil.TempDir("", "TestMakeParserReload")
+	defer os.RemoveAll(dir)
+	start := time.Now().Add(-time.Hour)
+	writeSpec(dir, "sample.csv", "name,size,datatype\nname,10,TEXT\n", start)
+	writeSpec(dir, "bank.csv", "#layout=D:bank_detail\n", start)
+	writeSpec(dir, "bank_detail.csv", "name,size,datatype\ntype,1,TEXT\n", start)
+	factory := NewDataParserFactory(dir + string(filepath.Separator))
+
+	p, err := factory.MakeParser("sample")
+	assert.Nil(err)
+	assert.Len(p.Meta(), 1)
+	cached, _ := factory.MakeParser("sample")
+	assert.True(p == cached)
+
+	writeSpec(dir, "sample.csv", "name,size,datatype\nname,10,TEXT\ncount,5,INTEGER\n", start.Add(time.Minute))
+	edited, err := factory.MakeParser("sample")
+	assert.Nil(err)
+	assert.Len(edited.Meta(), 2)
+	assert.NotEqual(p.Version(), edited.Version())
+
+	// an edited layout reads its spec of layouts again
+	bank, err := factory.MakeParser("bank")
+	assert.Nil(err)
+	writeSpec(dir, "bank_detail.csv", "name,size,datatype\ntype,1,TEXT\nname,5,TEXT\n", start.Add(time.Minute))
+	editedBank, err := factory.MakeParser("bank")
+	assert.Nil(err)
+	assert.Len(editedBank.Layouts()[0].Metas, 2)
+	assert.NotEqual(bank.Version(), editedBank.Version())
+
+	os.Remove(filepath.Join(dir, "sample.csv"))
+	_, err = factory.MakeParser("sample")
+	assert.Error(err)
+}
@@ -5,9 +5,13 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
 )
 
 type DataParserTestSuite struct {
@@ -65,11 +69,13 @@ func (s *DataScannerTestSuite) TestReadRowSuccess() {
 	row, haveData, err := scanner.ReadRow()
 	assert.Nil(s.T(), err)
 	assert.True(s.T(), haveData)
-	assert.Equal(s.T(), *row, map[string]interface{}{
-		"name":   "Hello",
-		"active": true,
-		"count":  123,
-	})
+	assert.Equal(s.T(), []interface{}{"Hello", true, 123}, row.Values)
+	assert.Equal(s.T(), []string{"name", "active", "count"}, row.Columns())
+	count, ok := row.Get("count")
+	assert.True(s.T(), ok)
+	assert.Equal(s.T(), 123, count)
+	_, ok = row.Get("missing")
+	assert.False(s.T(), ok)
 }
 
 func (s *DataScannerTestSuite) TestReadRowSuccessUTF8() {
@@ -81,7 +87,7 @@ func (s *DataScannerTestSuite) TestReadRowSuccessUTF8() {
 	row, haveData, err := scanner.ReadRow()
 	assert.Nil(s.T(), err)
 	assert.True(s.T(), haveData)
-	assert.Equal(s.T(), *row, map[string]interface{}{
+	assert.Equal(s.T(), row.Map(), map[string]interface{}{
 		"name":   "アイウエオ",
 		"active": true,
 		"count":  123,
@@ -99,7 +105,7 @@ ABC       1 4321`
 	row, haveData, err := scanner.ReadRow()
 	assert.Nil(s.T(), err)
 	assert.True(s.T(), haveData)
-	assert.Equal(s.T(), *row, map[string]interface{}{
+	assert.Equal(s.T(), row.Map(), map[string]interface{}{
 		"name":   "ABC",
 		"active": true,
 		"count":  4321,
@@ -141,6 +147,297 @@ func (s *DataScannerTestSuite) TestReadRowShouldReturnErrorWhenLengthShort() {
 	assert.Nil(s.T(), row)
 }
 
+func (s *DataScannerTestSuite) TestReadRowTypes() {
+	var datum = `2020032920200329153000  12.5012345678901 1.25`
+	scanner := &DataScanner{
+		Metas: []*SQLMeta{
+			&SQLMeta{Name: "day", Size: 8, DataType: "DATE"},
+			&SQLMeta{Name: "at", Size: 14, DataType: "TIMESTAMP"},
+			&SQLMeta{Name: "amount", Size: 7, DataType: "DECIMAL", Scale: 2},
+			&SQLMeta{Name: "big", Size: 11, DataType: "BIGINT"},
+			&SQLMeta{Name: "ratio", Size: 5, DataType: "FLOAT"},
+		},
+		Scanner: bufio.NewScanner(strings.NewReader(datum)),
+	}
+	row, haveData, err := scanner.ReadRow()
+	assert.Nil(s.T(), err)
+	assert.True(s.T(), haveData)
+	assert.Equal(s.T(), row.Map(), map[string]interface{}{
+		"day":    time.Date(2020, 3, 29, 0, 0, 0, 0, time.UTC),
+		"at":     time.Date(2020, 3, 29, 15, 30, 0, 0, time.UTC),
+		"amount": Decimal{Unscaled: "1250", Scale: 2},
+		"big":    int64(12345678901),
+		"ratio":  1.25,
+	})
+}
+
+func (s *DataScannerTestSuite) TestReadRowDateFormat() {
+	var datum = `29/03/2020`
+	scanner := &DataScanner{
+		Metas: []*SQLMeta{
+			&SQLMeta{Name: "day", Size: 10, DataType: "DATE", Format: "02/01/2006"},
+		},
+		Scanner: bufio.NewScanner(strings.NewReader(datum)),
+	}
+	row, _, err := scanner.ReadRow()
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), time.Date(2020, 3, 29, 0, 0, 0, 0, time.UTC), row.Map()["day"])
+}
+
+func (s *DataScannerTestSuite) TestReadRowMainframeNumbers() {
+	var datum = `0001234000123}12-`
+	scanner := &DataScanner{
+		Metas: []*SQLMeta{
+			&SQLMeta{Name: "amount", Size: 7, DataType: "DECIMAL", Scale: 2, Implied: true},
+			&SQLMeta{Name: "refund", Size: 7, DataType: "DECIMAL", Scale: 2, Implied: true, Sign: SignOverpunch},
+			&SQLMeta{Name: "count", Size: 3, DataType: "INTEGER", Sign: SignTrailing},
+		},
+		Scanner: bufio.NewScanner(strings.NewReader(datum)),
+	}
+	row, _, err := scanner.ReadRow()
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), row.Map(), map[string]interface{}{
+		"amount": Decimal{Unscaled: "1234", Scale: 2},
+		"refund": Decimal{Unscaled: "-1230", Scale: 2},
+		"count":  -12,
+	})
+}
+
+func (s *DataScannerTestSuite) TestReadRowWideDecimal() {
+	var datum = `1234567890123456789012345-98765432109876543210.5`
+	scanner := &DataScanner{
+		Metas: []*SQLMeta{
+			&SQLMeta{Name: "amount", Size: 25, DataType: "DECIMAL", Scale: 5, Implied: true},
+			&SQLMeta{Name: "refund", Size: 23, DataType: "DECIMAL", Scale: 1},
+		},
+		Scanner: bufio.NewScanner(strings.NewReader(datum)),
+	}
+	row, _, err := scanner.ReadRow()
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), "12345678901234567890.12345", row.Map()["amount"].(Decimal).String())
+	assert.Equal(s.T(), "-98765432109876543210.5", row.Map()["refund"].(Decimal).String())
+}
+
+func (s *DataScannerTestSuite) TestReadRowNull() {
+	var datum = `     00000000N/A       `
+	scanner := &DataScanner{
+		Metas: []*SQLMeta{
+			&SQLMeta{Name: "count", Size: 5, DataType: "INTEGER", Nullable: true, NullValues: []string{NullSpaces}},
+			&SQLMeta{Name: "day", Size: 8, DataType: "DATE", Nullable: true, NullValues: []string{NullZeros}},
+			&SQLMeta{Name: "code", Size: 5, DataType: "TEXT", Nullable: true, NullValues: []string{"N/A"}},
+			&SQLMeta{Name: "name", Size: 5, DataType: "TEXT"},
+		},
+		Scanner: bufio.NewScanner(strings.NewReader(datum)),
+	}
+	row, _, err := scanner.ReadRow()
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), row.Map(), map[string]interface{}{
+		"count": nil,
+		"day":   nil,
+		"code":  nil,
+		"name":  "",
+	})
+}
+
+func (s *DataScannerTestSuite) TestReadRowBlankNotNullable() {
+	var datum = `     `
+	scanner := &DataScanner{
+		Metas: []*SQLMeta{
+			&SQLMeta{Name: "count", Size: 5, DataType: "INTEGER"},
+		},
+		Scanner: bufio.NewScanner(strings.NewReader(datum)),
+	}
+	_, _, err := scanner.ReadRow()
+	assert.Error(s.T(), err)
+}
+
+func (s *DataScannerTestSuite) TestReadRowWidthUnits() {
+	cases := []struct {
+		unit  string
+		datum string
+		name  string
+	}{
+		{WidthRunes, "アイウエオ     1  123", "アイウエオ"},
+		{WidthBytes, "アイウ 1  123", "アイウ"},
+		{WidthColumns, "アイウエオ1  123", "アイウエオ"},
+		{WidthColumns, "ｱｲｳｴｵ     1  123", "ｱｲｳｴｵ"},
+	}
+	for _, c := range cases {
+		scanner := &DataScanner{
+			Metas:   s.Meta,
+			Options: SpecOptions{WidthUnit: c.unit},
+			Scanner: bufio.NewScanner(strings.NewReader(c.datum)),
+		}
+		row, haveData, err := scanner.ReadRow()
+		assert.Nil(s.T(), err, c.unit)
+		assert.True(s.T(), haveData)
+		assert.Equal(s.T(), map[string]interface{}{
+			"name":   c.name,
+			"active": true,
+			"count":  123,
+		}, row.Map(), c.unit)
+	}
+}
+
+func (s *DataScannerTestSuite) TestReadRowWidthColumnsSplitWide() {
+	scanner := &DataScanner{
+		Metas:   s.Meta,
+		Options: SpecOptions{WidthUnit: WidthColumns},
+		Scanner: bufio.NewScanner(strings.NewReader("aアイウエオ1  123")),
+	}
+	_, haveData, err := scanner.ReadRow()
+	assert.True(s.T(), haveData)
+	assert.Error(s.T(), err)
+}
+
+func (s *DataScannerTestSuite) TestReadRowEncodings() {
+	cases := []struct {
+		encoding encoding.Encoding
+		name     string
+		unit     string
+		datum    string
+	}{
+		{japanese.ShiftJIS, EncodingShiftJIS, WidthBytes, "アイウエ  1  123"},
+		{japanese.ShiftJIS, EncodingShiftJIS, WidthRunes, "アイウエ      1  123"},
+		{japanese.EUCJP, EncodingEUCJP, WidthBytes, "アイウエ  1  123"},
+		{charmap.ISO8859_1, EncodingLatin1, WidthRunes, "Grüße     1  123"},
+	}
+	for _, c := range cases {
+		raw, err := c.encoding.NewEncoder().String(c.datum + "\n" + c.datum)
+		assert.Nil(s.T(), err)
+		scanner := &DataScanner{
+			Metas:   s.Meta,
+			Options: SpecOptions{WidthUnit: c.unit},
+			Scanner: bufio.NewScanner(strings.NewReader(raw)),
+		}
+		assert.Nil(s.T(), scanner.SetEncoding(c.name))
+		for i := 0; i < 2; i++ {
+			row, haveData, err := scanner.ReadRow()
+			assert.Nil(s.T(), err, c.name)
+			assert.True(s.T(), haveData)
+			assert.Equal(s.T(), map[string]interface{}{
+				"name":   strings.TrimSpace(c.datum[:strings.Index(c.datum, " ")]),
+				"active": true,
+				"count":  123,
+			}, row.Map(), c.name)
+			assert.Equal(s.T(), c.datum, scanner.Text())
+		}
+	}
+}
+
+func (s *DataScannerTestSuite) TestReadRowEBCDIC() {
+	raw, _ := charmap.CodePage037.NewEncoder().String("Hello     1  123\u0085World     0  321\n")
+	scanner := &DataScanner{
+		Metas:   s.Meta,
+		Scanner: bufio.NewScanner(strings.NewReader(raw)),
+	}
+	assert.Nil(s.T(), scanner.SetEncoding(EncodingEBCDIC))
+	row, _, err := scanner.ReadRow()
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), "Hello", row.Map()["name"])
+	row, _, err = scanner.ReadRow()
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), 321, row.Map()["count"])
+	_, haveData, _ := scanner.ReadRow()
+	assert.False(s.T(), haveData)
+
+	assert.Error(s.T(), scanner.SetEncoding("klingon"))
+}
+
+func (s *DataScannerTestSuite) TestReadRowRecords() {
+	scanner := &DataScanner{
+		Metas:   s.Meta,
+		Scanner: bufio.NewScanner(strings.NewReader("Hello     1  123    World     0  321    ")),
+	}
+	assert.Nil(s.T(), scanner.SetOptions(SpecOptions{RecordLength: 20, WidthUnit: WidthBytes}))
+	row, _, err := scanner.ReadRow()
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), "Hello", row.Map()["name"])
+	row, _, err = scanner.ReadRow()
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), "World", row.Map()["name"])
+	assert.Equal(s.T(), 2, scanner.Line())
+	_, haveData, err := scanner.ReadRow()
+	assert.False(s.T(), haveData)
+	assert.Nil(s.T(), err)
+}
+
+func (s *DataScannerTestSuite) TestReadRowRecordsMultibyte() {
+	metas := []*SQLMeta{
+		&SQLMeta{Name: "name", Size: 6, DataType: "TEXT"},
+		&SQLMeta{Name: "count", Size: 3, DataType: "INTEGER"},
+	}
+	// é is two bytes of the six of its field
+	scanner := &DataScanner{
+		Metas:   metas,
+		Scanner: bufio.NewScanner(strings.NewReader("héllo123world 456")),
+	}
+	assert.Error(s.T(), scanner.SetOptions(SpecOptions{RecordLength: 9}))
+	assert.Nil(s.T(), scanner.SetOptions(SpecOptions{RecordLength: 9, WidthUnit: WidthBytes}))
+	row, _, err := scanner.ReadRow()
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), []interface{}{"héllo", 123}, row.Values)
+	row, _, err = scanner.ReadRow()
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), []interface{}{"world", 456}, row.Values)
+}
+
+func (s *DataScannerTestSuite) TestReadRowRecordsIncomplete() {
+	scanner := &DataScanner{
+		Metas:   s.Meta,
+		Scanner: bufio.NewScanner(strings.NewReader("Hello     1  123World")),
+	}
+	assert.Nil(s.T(), scanner.SetOptions(SpecOptions{RecordLength: 16, WidthUnit: WidthBytes}))
+	_, _, err := scanner.ReadRow()
+	assert.Nil(s.T(), err)
+	_, haveData, err := scanner.ReadRow()
+	assert.False(s.T(), haveData)
+	assert.Error(s.T(), err)
+}
+
+func (s *DataScannerTestSuite) TestReadRowLongLine() {
+	wide := []*SQLMeta{&SQLMeta{Name: "payload", Size: 100000, DataType: "TEXT"}}
+	data := strings.Repeat("a", 100000) + "\n" + strings.Repeat("b", 100000) + "\n"
+	scanner := &DataScanner{
+		Metas:   wide,
+		Scanner: bufio.NewScanner(strings.NewReader(data)),
+	}
+	assert.Nil(s.T(), scanner.SetOptions(SpecOptions{}))
+	for i := 0; i < 2; i++ {
+		row, haveData, err := scanner.ReadRow()
+		assert.Nil(s.T(), err)
+		assert.True(s.T(), haveData)
+		assert.Len(s.T(), row.Map()["payload"], 100000)
+	}
+	_, haveData, err := scanner.ReadRow()
+	assert.False(s.T(), haveData)
+	assert.Nil(s.T(), err)
+}
+
+func (s *DataScannerTestSuite) TestReadRowTooLong() {
+	scanner := &DataScanner{
+		Metas:   s.Meta,
+		Scanner: bufio.NewScanner(strings.NewReader("Hello     1  123\nWorld     0  321 and some trailing garbage\n")),
+	}
+	assert.Nil(s.T(), scanner.SetOptions(SpecOptions{MaxRecordLength: 16}))
+	_, _, err := scanner.ReadRow()
+	assert.Nil(s.T(), err)
+	_, haveData, err := scanner.ReadRow()
+	assert.False(s.T(), haveData)
+	assert.EqualError(s.T(), err, "Fail to read line 2, longer than the max record length of 16 bytes")
+
+	assert.Error(s.T(), scanner.SetMaxRecordLength(0))
+
+	// a fixed length record always fits
+	scanner = &DataScanner{
+		Metas:   s.Meta,
+		Scanner: bufio.NewScanner(strings.NewReader("Hello     1  123    ")),
+	}
+	assert.Nil(s.T(), scanner.SetOptions(SpecOptions{RecordLength: 20, WidthUnit: WidthBytes, MaxRecordLength: 8}))
+	_, _, err = scanner.ReadRow()
+	assert.Nil(s.T(), err)
+}
+
 func TestDataParser(t *testing.T) {
 	t.Parallel()
 	suite.Run(t, new(DataParserTestSuite))
@@ -0,0 +1,179 @@
+package parser
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+)
+
+// Decimal is an exact fixed point number, Unscaled * 10^-Scale.
+// It is sent to postgres as text so NUMERIC columns keep every digit.
+// Unscaled is the digits with their sign, like "-1234", so no width of
+// field overflows it.
+type Decimal struct {
+	Unscaled string
+	Scale    int
+}
+
+// ParseDecimal reads a plain decimal literal like "-12.34" and rescales it
+// to scale digits after the point, failing if precision would be lost.
+func ParseDecimal(datum string, scale int) (Decimal, error) {
+	datum = strings.TrimSpace(datum)
+	if datum == "" {
+		return Decimal{}, fmt.Errorf("empty decimal")
+	}
+	intPart, fracPart := datum, ""
+	if i := strings.IndexByte(datum, '.'); i >= 0 {
+		intPart, fracPart = datum[:i], datum[i+1:]
+	}
+	if len(fracPart) > scale {
+		if strings.Trim(fracPart[scale:], "0") != "" {
+			return Decimal{}, fmt.Errorf("%q has more than %d decimal places", datum, scale)
+		}
+		fracPart = fracPart[:scale]
+	}
+	fracPart += strings.Repeat("0", scale-len(fracPart))
+	if intPart == "" || intPart == "-" || intPart == "+" {
+		intPart += "0"
+	}
+	unscaled, ok := unscaledDigits(intPart + fracPart)
+	if !ok {
+		return Decimal{}, fmt.Errorf("invalid decimal %q", datum)
+	}
+	return Decimal{Unscaled: unscaled, Scale: scale}, nil
+}
+
+// unscaledDigits reads an integer of any length with an optional sign, it
+// returns the digits without leading zeros and the sign only when negative
+func unscaledDigits(datum string) (string, bool) {
+	sign, digits := "", datum
+	if digits != "" && (digits[0] == '-' || digits[0] == '+') {
+		if digits[0] == '-' {
+			sign = "-"
+		}
+		digits = digits[1:]
+	}
+	if digits == "" {
+		return "", false
+	}
+	for i := 0; i < len(digits); i++ {
+		if digits[i] < '0' || digits[i] > '9' {
+			return "", false
+		}
+	}
+	digits = strings.TrimLeft(digits, "0")
+	if digits == "" {
+		return "0", true
+	}
+	return sign + digits, true
+}
+
+func (d Decimal) String() string {
+	digits, sign := d.Unscaled, ""
+	if digits == "" {
+		digits = "0"
+	}
+	if strings.HasPrefix(digits, "-") {
+		sign, digits = "-", digits[1:]
+	}
+	if d.Scale <= 0 {
+		return sign + digits
+	}
+	if len(digits) <= d.Scale {
+		digits = strings.Repeat("0", d.Scale-len(digits)+1) + digits
+	}
+	point := len(digits) - d.Scale
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// sign styles of numeric fields
+const (
+	SignLeading          = "LEADING"
+	SignTrailing         = "TRAILING"
+	SignOverpunch        = "OVERPUNCH"
+	SignLeadingOverpunch = "LEADING_OVERPUNCH"
+)
+
+// decodeSign rewrites a signed numeric field to a plain "-123" literal.
+// Overpunch is the COBOL zoned decimal convention where the sign shares a
+// byte with the last (or first) digit, e.g. "123}" is -1230.
+func decodeSign(datum, style string) (string, error) {
+	datum = strings.TrimSpace(datum)
+	if datum == "" || style == "" {
+		return datum, nil
+	}
+	last := len(datum) - 1
+	switch style {
+	case SignLeading:
+		return applySign(datum[0], datum[1:], datum)
+	case SignTrailing:
+		return applySign(datum[last], datum[:last], datum)
+	case SignOverpunch:
+		digit, negative, err := overpunch(datum[last])
+		if err != nil {
+			return "", err
+		}
+		return signed(datum[:last]+digit, negative), nil
+	case SignLeadingOverpunch:
+		digit, negative, err := overpunch(datum[0])
+		if err != nil {
+			return "", err
+		}
+		return signed(digit+datum[1:], negative), nil
+	}
+	return "", fmt.Errorf("unknown sign style %s", style)
+}
+
+// a blank sign was trimmed away with the padding, so a digit in its place
+// means the field is positive
+func applySign(sign byte, digits, datum string) (string, error) {
+	if sign >= '0' && sign <= '9' {
+		return datum, nil
+	}
+	switch sign {
+	case '-':
+		return signed(strings.TrimSpace(digits), true), nil
+	case '+', ' ':
+		return strings.TrimSpace(digits), nil
+	}
+	return "", fmt.Errorf("invalid sign %q", sign)
+}
+
+func signed(digits string, negative bool) string {
+	if negative {
+		return "-" + digits
+	}
+	return digits
+}
+
+func overpunch(c byte) (string, bool, error) {
+	switch {
+	case c >= '0' && c <= '9':
+		return string(c), false, nil
+	case c == '{':
+		return "0", false, nil
+	case c >= 'A' && c <= 'I':
+		return string('1' + c - 'A'), false, nil
+	case c == '}':
+		return "0", true, nil
+	case c >= 'J' && c <= 'R':
+		return string('1' + c - 'J'), true, nil
+	case c >= 'p' && c <= 'y':
+		return string('0' + c - 'p'), true, nil
+	}
+	return "", false, fmt.Errorf("invalid overpunch %q", c)
+}
+
+// parseImplied reads digits whose last scale digits are decimals, so
+// "0001234" with scale 2 is 12.34.
+func parseImplied(datum string, scale int) (Decimal, error) {
+	unscaled, ok := unscaledDigits(datum)
+	if !ok {
+		return Decimal{}, fmt.Errorf("invalid implied decimal %q", datum)
+	}
+	return Decimal{Unscaled: unscaled, Scale: scale}, nil
+}
@@ -0,0 +1,85 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDecimal(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	cases := map[string]Decimal{
+		"12.34":   Decimal{Unscaled: "1234", Scale: 2},
+		" -1.5 ":  Decimal{Unscaled: "-150", Scale: 2},
+		"7":       Decimal{Unscaled: "700", Scale: 2},
+		".05":     Decimal{Unscaled: "5", Scale: 2},
+		"+3.1000": Decimal{Unscaled: "310", Scale: 2},
+		"-0.00":   Decimal{Unscaled: "0", Scale: 2},
+		// wider than an int64
+		"123456789012345678901.23": Decimal{Unscaled: "12345678901234567890123", Scale: 2},
+	}
+	for datum, expected := range cases {
+		d, err := ParseDecimal(datum, 2)
+		assert.Nil(err, datum)
+		assert.Equal(expected, d, datum)
+	}
+	for _, datum := range []string{"", "1.234", "1.2.3", "abc", "1.-2", "1 2"} {
+		_, err := ParseDecimal(datum, 2)
+		assert.Error(err, datum)
+	}
+}
+
+func TestDecimalString(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	assert.Equal("12.34", Decimal{Unscaled: "1234", Scale: 2}.String())
+	assert.Equal("-0.05", Decimal{Unscaled: "-5", Scale: 2}.String())
+	assert.Equal("42", Decimal{Unscaled: "42"}.String())
+	assert.Equal("0.00", Decimal{Scale: 2}.String())
+	v, err := Decimal{Unscaled: "100", Scale: 1}.Value()
+	assert.Nil(err)
+	assert.Equal("10.0", v)
+}
+
+func TestDecodeSign(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	cases := []struct {
+		datum, style, expected string
+	}{
+		{" 12 ", "", "12"},
+		{"-123", SignLeading, "-123"},
+		{"+123", SignLeading, "123"},
+		{"123-", SignTrailing, "-123"},
+		{"123 ", SignTrailing, "123"},
+		{"123}", SignOverpunch, "-1230"},
+		{"123{", SignOverpunch, "1230"},
+		{"12C", SignOverpunch, "123"},
+		{"12L", SignOverpunch, "-123"},
+		{"12r", SignOverpunch, "-122"},
+		{"J23", SignLeadingOverpunch, "-123"},
+		{"A23", SignLeadingOverpunch, "123"},
+	}
+	for _, c := range cases {
+		out, err := decodeSign(c.datum, c.style)
+		assert.Nil(err, c.datum)
+		assert.Equal(c.expected, out, c.datum)
+	}
+	_, err := decodeSign("12#", SignOverpunch)
+	assert.Error(err)
+	_, err = decodeSign("*12", SignLeading)
+	assert.Error(err)
+}
+
+func TestParseImplied(t *testing.T) {
+	t.Parallel()
+	d, err := parseImplied("0001234", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, "12.34", d.String())
+	d, err = parseImplied("-00012345678901234567890", 4)
+	assert.Nil(t, err)
+	assert.Equal(t, "-1234567890123456.7890", d.String())
+	_, err = parseImplied("12.34", 2)
+	assert.Error(t, err)
+}
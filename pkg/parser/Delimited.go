@@ -0,0 +1,370 @@
+package parser
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/text/transform"
+)
+
+// formats of the data files, a spec is fixed width unless #format says
+// otherwise
+const (
+	FormatFixed     = "fixed"
+	FormatDelimited = "delimited"
+)
+
+// DelimitedParser reads delimited files like csv, tsv or pipe separated
+// with the columns of a spec, whose widths then only size the columns
+type DelimitedParser struct {
+	Metas       []*SQLMeta
+	Options     SpecOptions
+	SpecVersion string
+}
+
+func (dp *DelimitedParser) Parse(filePath string) (*DataScanner, error) {
+	file, err := OpenData(filePath)
+	if err != nil {
+		return nil, err
+	}
+	scanner := &DataScanner{
+		Metas: dp.Metas,
+		file:  file,
+	}
+	err = scanner.SetOptions(dp.Options)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return scanner, nil
+}
+
+func (dp *DelimitedParser) Meta() []*SQLMeta {
+	return dp.Metas
+}
+
+func (dp *DelimitedParser) Layouts() []*Layout {
+	return nil
+}
+
+func (dp *DelimitedParser) Version() string {
+	return dp.SpecVersion
+}
+
+// delimitedReader reads the records of a delimited file, quoted as csv
+// unless the spec has #quote=none
+type delimitedReader struct {
+	csv       *csv.Reader
+	limiter   *recordLimiter
+	lines     *bufio.Scanner
+	delimiter string
+	// columns is the field of every meta in a record
+	columns []int
+	fields  int
+	record  []string
+	// line is the line the last record starts on, blank lines and new
+	// lines in quoted fields count
+	line int
+	// max is the longest line or record
+	max int
+	// ahead are the records read ahead after a quote error
+	ahead []pendingRecord
+}
+
+type pendingRecord struct {
+	record []string
+	line   int
+	err    error
+}
+
+func newDelimitedReader(input io.Reader, options SpecOptions) *delimitedReader {
+	delimiter := options.Delimiter
+	if delimiter == "" {
+		delimiter = ","
+	}
+	reader := &delimitedReader{delimiter: delimiter, max: options.maxRecordLength()}
+	if options.NoQuote {
+		reader.lines = bufio.NewScanner(input)
+		reader.lines.Buffer(newScanBuffer(options))
+		return reader
+	}
+	reader.limiter = &recordLimiter{
+		input:     input,
+		delimiter: []byte(delimiter),
+		max:       reader.max + lineEndSize,
+		empty:     true,
+	}
+	reader.csv = csv.NewReader(reader.limiter)
+	reader.csv.Comma = []rune(delimiter)[0]
+	reader.csv.FieldsPerRecord = -1
+	return reader
+}
+
+// read returns the next record, io.EOF at the end
+func (r *delimitedReader) read() ([]string, error) {
+	if r.csv != nil {
+		var next pendingRecord
+		if len(r.ahead) > 0 {
+			next, r.ahead = r.ahead[0], r.ahead[1:]
+		} else {
+			next = r.readChecked()
+		}
+		r.record, r.line = next.record, next.line
+		return next.record, next.err
+	}
+	for r.lines.Scan() {
+		r.line++
+		// blank lines are skipped as csv does
+		if r.lines.Text() == "" {
+			continue
+		}
+		if len(r.lines.Bytes()) > r.max {
+			return nil, bufio.ErrTooLong
+		}
+		r.record = strings.Split(r.lines.Text(), r.delimiter)
+		return r.record, nil
+	}
+	if err := r.lines.Err(); err != nil {
+		// the line failed to scan
+		r.line++
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// readChecked reads the next record with its line. It fails the file on an
+// error that may have swallowed the records after it: csv reads on after a
+// quote left open, up to the end of the data, so an error over several
+// lines or a quote error followed by the end is not a bad row.
+func (r *delimitedReader) readChecked() pendingRecord {
+	var next pendingRecord
+	next.record, next.err = r.csv.Read()
+	if next.err == io.EOF {
+		return next
+	}
+	next.line = r.limiter.nextLine()
+	parseErr, ok := next.err.(*csv.ParseError)
+	if !ok || parseErr.Err != csv.ErrQuote && parseErr.StartLine == parseErr.Line {
+		return next
+	}
+	if parseErr.StartLine != parseErr.Line {
+		next.err = fmt.Errorf("record from line %d to %d, %v", parseErr.StartLine, parseErr.Line, parseErr.Err)
+		return next
+	}
+	// the records read ahead by the peek go after it
+	peek := r.readChecked()
+	if peek.err == io.EOF {
+		next.err = fmt.Errorf("quote left open up to the end of the data on line %d", parseErr.Line)
+		return next
+	}
+	r.ahead = append([]pendingRecord{peek}, r.ahead...)
+	return next
+}
+
+// states of a recordLimiter in a record
+const (
+	fieldStart = iota
+	unquoted
+	quoted
+	quoteInQuoted
+)
+
+// recordLimiter fails with bufio.ErrTooLong past max bytes of a quoted
+// record, as the scanners do past the max record length, instead of letting
+// csv buffer a record of any size. It follows the quotes to tell the end of
+// a record from a new line in a quoted field.
+type recordLimiter struct {
+	input     io.Reader
+	delimiter []byte
+	max       int
+	length    int
+	state     int
+	// matched is the bytes of the delimiter read so far
+	matched int
+	err     error
+	// line counts the new lines read, start is the line of the record
+	// being read, empty until it has more than a line end
+	line  int
+	start int
+	empty bool
+	// starts are the lines of the records read, csv skips the empty ones
+	starts []int
+}
+
+func (r *recordLimiter) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	n, err := r.input.Read(p)
+	for i := 0; i < n; i++ {
+		r.length++
+		if r.length > r.max {
+			r.err = bufio.ErrTooLong
+			return i, r.err
+		}
+		end := r.next(p[i])
+		if p[i] == '\n' {
+			r.line++
+		}
+		switch {
+		case end:
+			if !r.empty {
+				r.starts = append(r.starts, r.start+1)
+			}
+			r.start, r.empty, r.length = r.line, true, 0
+		case p[i] != '\r':
+			r.empty = false
+		}
+	}
+	return n, err
+}
+
+// nextLine is the line of the next record csv returns, csv reads ahead so
+// the lines of the records are kept until it gets to them
+func (r *recordLimiter) nextLine() int {
+	if len(r.starts) == 0 {
+		// the last record has no line end
+		return r.start + 1
+	}
+	line := r.starts[0]
+	r.starts = r.starts[1:]
+	return line
+}
+
+// next moves the state by one byte, it is true at the end of a record
+func (r *recordLimiter) next(b byte) bool {
+	delimited := r.delimited(b)
+	switch {
+	case r.state == quoted:
+		if b == '"' {
+			r.state = quoteInQuoted
+		}
+	case b == '\n':
+		r.state = fieldStart
+		return true
+	case b == '"' && (r.state == fieldStart || r.state == quoteInQuoted):
+		r.state = quoted
+	case delimited:
+		r.state = fieldStart
+	default:
+		r.state = unquoted
+	}
+	return false
+}
+
+// delimited is true on the last byte of a delimiter out of quotes
+func (r *recordLimiter) delimited(b byte) bool {
+	switch {
+	case r.state == quoted:
+		r.matched = 0
+	case b == r.delimiter[r.matched]:
+		r.matched++
+	case b == r.delimiter[0]:
+		r.matched = 1
+	default:
+		r.matched = 0
+	}
+	if r.matched < len(r.delimiter) {
+		return false
+	}
+	r.matched = 0
+	return true
+}
+
+// matchHeader finds the field of every meta by name in the header record
+func (r *delimitedReader) matchHeader(header []string, metas []*SQLMeta) error {
+	index := make(map[string]int)
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	r.columns = make([]int, len(metas))
+	for i, meta := range metas {
+		column, ok := index[strings.ToLower(meta.Name)]
+		if !ok {
+			return fmt.Errorf("no column %s in the header", meta.Name)
+		}
+		r.columns[i] = column
+	}
+	r.fields = len(header)
+	return nil
+}
+
+// readDelimited is ReadRow of a delimited file
+func (ds *DataScanner) readDelimited() (*Row, bool, error) {
+	if ds.delimited == nil {
+		var input io.Reader = ds.file
+		if ds.source != nil && ds.source.encoding != nil {
+			input = transform.NewReader(input, ds.source.encoding.NewDecoder())
+		}
+		ds.delimited = newDelimitedReader(input, ds.Options)
+		if ds.Options.Headerless {
+			ds.delimited.columns = make([]int, len(ds.Metas))
+			for i := range ds.Metas {
+				ds.delimited.columns[i] = i
+			}
+			ds.delimited.fields = len(ds.Metas)
+		} else {
+			header, err := ds.delimited.read()
+			if err == io.EOF {
+				return nil, false, nil
+			}
+			if err != nil {
+				return nil, false, ds.readError(err)
+			}
+			ds.line = ds.delimited.line
+			err = ds.delimited.matchHeader(header, ds.Metas)
+			if err != nil {
+				return nil, false, err
+			}
+		}
+	}
+
+	record, err := ds.delimited.read()
+	if err == io.EOF {
+		return nil, false, nil
+	}
+	if _, ok := err.(*csv.ParseError); err != nil && !ok {
+		return nil, false, ds.readError(err)
+	}
+	ds.line = ds.delimited.line
+	if err != nil {
+		return nil, true, err
+	}
+	if len(record) != ds.delimited.fields {
+		return nil, true, fmt.Errorf("%d fields instead of %d", len(record), ds.delimited.fields)
+	}
+	row := NewRow(ds.Metas)
+	for i, meta := range ds.Metas {
+		row.Values[i], err = parseData(record[ds.delimited.columns[i]], meta)
+		if err != nil {
+			return nil, true, err
+		}
+	}
+	return row, true, nil
+}
+
+// readError is scanError on the line the delimited reader failed
+func (ds *DataScanner) readError(err error) error {
+	ds.line = ds.delimited.line - 1
+	return ds.scanError(err)
+}
+
+// checkFormat refuses the options of fixed width files on a delimited spec
+func (o *SpecOptions) checkFormat() error {
+	if o.Format != FormatDelimited {
+		if o.Delimiter != "" || o.NoQuote || o.Headerless {
+			return fmt.Errorf("delimiter, quote or has_header without format=delimited")
+		}
+		return nil
+	}
+	if o.WidthUnit != "" || o.RecordLength != 0 || len(o.Layouts) > 0 {
+		return fmt.Errorf("width_unit, record_length or layout with format=delimited")
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package parser
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/encoding/japanese"
+)
+
+var testDelimitedMetas = []*SQLMeta{
+	&SQLMeta{Name: "name", Size: 10, DataType: "TEXT"},
+	&SQLMeta{Name: "active", Size: 1, DataType: "BOOLEAN"},
+	&SQLMeta{Name: "count", Size: 5, DataType: "INTEGER"},
+}
+
+func readDelimited(data string, options SpecOptions) ([]map[string]interface{}, []error, error) {
+	file, _ := ioutil.TempFile("", "TestDelimited")
+	file.WriteString(data)
+	file.Close()
+	defer os.Remove(file.Name())
+
+	options.Format = FormatDelimited
+	p := &DelimitedParser{Metas: testDelimitedMetas, Options: options}
+	scanner, err := p.Parse(file.Name())
+	if err != nil {
+		return nil, nil, err
+	}
+	defer scanner.Close()
+	var rows []map[string]interface{}
+	var rowErrors []error
+	for {
+		row, haveData, err := scanner.ReadRow()
+		if !haveData {
+			return rows, rowErrors, err
+		}
+		if err != nil {
+			rowErrors = append(rowErrors, err)
+			continue
+		}
+		rows = append(rows, row.Map())
+	}
+}
+
+func TestReadDelimited(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	want := []map[string]interface{}{
+		{"name": "Hello, World", "active": true, "count": 123},
+		{"name": `say "hi"`, "active": false, "count": 7},
+	}
+	cases := []struct {
+		data    string
+		options SpecOptions
+	}{
+		{"\ufeffCount,Name,active,extra\n123,\"Hello, World\",1,x\n7,\"say \"\"hi\"\"\",0,y\n", SpecOptions{}},
+		{"Hello, World\t1\t123\nsay \"hi\"\t0\t7\n\n", SpecOptions{Delimiter: "\t", Headerless: true, NoQuote: true}},
+		{"name|active|count\nHello, World|1|123\n\"say \"\"hi\"\"\"|0|7", SpecOptions{Delimiter: "|"}},
+	}
+	for _, c := range cases {
+		rows, rowErrors, err := readDelimited(c.data, c.options)
+		assert.Nil(err, c.data)
+		assert.Empty(rowErrors, c.data)
+		assert.Equal(want, rows, c.data)
+	}
+}
+
+func TestReadDelimitedBadRows(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	rows, rowErrors, err := readDelimited("name,active,count\nHello,1,123\nWorld,1\n\"bad\"quote,1,2\nabc,1,x\nEnd,0,1\n", SpecOptions{})
+	assert.Nil(err)
+	assert.Len(rowErrors, 3)
+	assert.Len(rows, 2)
+
+	_, _, err = readDelimited("name,count\nHello,123\n", SpecOptions{})
+	assert.Error(err)
+
+	rows, _, err = readDelimited("Hello\t1\t123\nWorld\t0\t4567890\n", SpecOptions{Delimiter: "\t", NoQuote: true, Headerless: true, MaxRecordLength: 12})
+	assert.EqualError(err, "Fail to read line 2, longer than the max record length of 12 bytes")
+	assert.Len(rows, 1)
+}
+
+func TestReadDelimitedMaxRecordLength(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	options := SpecOptions{MaxRecordLength: 20}
+	// quoted new lines and delimiters stay in the record
+	rows, rowErrors, err := readDelimited("name,active,count\n\"a,\nb\"\"\nc\",1,1\nd,1,2\ne,1,3\nf,1,4\ng,1,5\n", options)
+	assert.Nil(err)
+	assert.Empty(rowErrors)
+	assert.Len(rows, 5)
+
+	rows, _, err = readDelimited("name§active§count\n\"a§\nb\"§1§1\nd§1§2\ne§1§3\n", SpecOptions{Delimiter: "§", MaxRecordLength: 20})
+	assert.Nil(err)
+	assert.Len(rows, 3)
+
+	rows, _, err = readDelimited("name,active,count\nHello,1,123\n\""+strings.Repeat("x", 5000)+"\",1,2\nEnd,0,1\n", options)
+	assert.EqualError(err, "Fail to read line 3, longer than the max record length of 20 bytes")
+	assert.Len(rows, 1)
+
+	rows, _, err = readDelimited("name,active,count\nHello,1,123\n\""+strings.Repeat("x\n", 20)+"\",1,2\n", options)
+	assert.EqualError(err, "Fail to read line 3, longer than the max record length of 20 bytes")
+	assert.Len(rows, 1)
+}
+
+// readDelimitedLines returns the line of every row and bad row
+func readDelimitedLines(data string, options SpecOptions) ([]int, error) {
+	file, _ := ioutil.TempFile("", "TestDelimitedLines")
+	file.WriteString(data)
+	file.Close()
+	defer os.Remove(file.Name())
+
+	options.Format = FormatDelimited
+	p := &DelimitedParser{Metas: testDelimitedMetas, Options: options}
+	scanner, err := p.Parse(file.Name())
+	if err != nil {
+		return nil, err
+	}
+	defer scanner.Close()
+	var lines []int
+	for {
+		_, haveData, err := scanner.ReadRow()
+		if !haveData {
+			return lines, err
+		}
+		lines = append(lines, scanner.Line())
+	}
+}
+
+func TestReadDelimitedLines(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	// new lines in quoted fields and blank lines are lines of the file
+	data := "name,active,count\r\n\"a\r\nb\",1,1\r\n\r\nc,1,x\r\n\"d\"x,1,3\r\n\"e\"y,1,4\r\n\"f\n\ng\",0,5"
+	lines, err := readDelimitedLines(data, SpecOptions{})
+	assert.Nil(err)
+	assert.Equal([]int{2, 5, 6, 7, 8}, lines)
+
+	lines, err = readDelimitedLines("a|1|1\n\nb|1|2\n\n\nc|1|3\n", SpecOptions{Delimiter: "|", NoQuote: true, Headerless: true})
+	assert.Nil(err)
+	assert.Equal([]int{1, 3, 6}, lines)
+
+	_, err = readDelimitedLines("name,active,count\n\"a\nb\",1,1\n\n"+strings.Repeat("x", 30)+",1,2\n", SpecOptions{MaxRecordLength: 20})
+	assert.EqualError(err, "Fail to read line 5, longer than the max record length of 20 bytes")
+}
+
+func TestReadDelimitedEncoding(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	data, _ := japanese.ShiftJIS.NewEncoder().String("name,active,count\nアイウ,1,123\n")
+	rows, _, err := readDelimited(data, SpecOptions{Encoding: EncodingShiftJIS})
+	assert.Nil(err)
+	assert.Equal("アイウ", rows[0]["name"])
+}
+
+func TestReadDelimitedText(t *testing.T) {
+	assert := assert.New(t)
+	scanner := &DataScanner{Metas: testDelimitedMetas}
+	scanner.SetOptions(SpecOptions{Format: FormatDelimited, Delimiter: "|", NoQuote: true, Headerless: true})
+	scanner.delimited = newDelimitedReader(bufio.NewReader(strings.NewReader("abc|1\n")), scanner.Options)
+	scanner.delimited.columns = []int{0, 1, 2}
+	scanner.delimited.fields = 3
+	_, haveData, err := scanner.ReadRow()
+	assert.True(haveData)
+	assert.Error(err)
+	assert.Equal("abc|1", scanner.Text())
+	assert.Equal(1, scanner.Line())
+}
+
+func TestParseFormatOptions(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	spec := "name,size,datatype\nname,10,TEXT\n"
+	parser := &SQLMetaCSVParser{
+		filePath: "TestParseFormatOptions",
+		buffer:   []byte("#format=delimited\n#delimiter=tab\n#quote=none\n#has_header=false\n" + spec),
+	}
+	_, err := parser.Parse()
+	assert.Nil(err)
+	assert.Equal(SpecOptions{Format: FormatDelimited, Delimiter: "\t", NoQuote: true, Headerless: true}, parser.Options())
+
+	for _, options := range []string{
+		"#format=xml\n",
+		"#delimiter=,\n",
+		"#format=delimited\n#delimiter=;;\n",
+		"#format=delimited\n#width_unit=bytes\n",
+		"#format=delimited\n#quote=single\n",
+	} {
+		parser = &SQLMetaCSVParser{filePath: "TestParseFormatOptions", buffer: []byte(options + spec)}
+		_, err = parser.Parse()
+		assert.Error(err, options)
+	}
+}
+
+func TestMakeParserDelimited(t *testing.T) {
+	assert := assert.New(t)
+	dir, _ := ioutil.TempDir("", "TestMakeParserDelimited")
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "feed.csv"), []byte("#format=delimited\nname,size,datatype\nname,10,TEXT\n"), 0644)
+	p, err := NewDataParserFactory(dir + string(filepath.Separator)).MakeParser("feed")
+	assert.Nil(err)
+	assert.IsType(&DelimitedParser{}, p)
+}
+
+func TestReadDelimitedOpenQuote(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	// csv reads the rows after an open quote into its field
+	rows, rowErrors, err := readDelimited("name,active,count\na,1,1\n\"b,1,2\nc,1,3\nd,1,4\ne,1,5\n", SpecOptions{})
+	assert.Error(err)
+	assert.Empty(rowErrors)
+	assert.Len(rows, 1)
+
+	// on the last line nothing follows it
+	rows, rowErrors, err = readDelimited("name,active,count\na,1,1\n\"e,1,5", SpecOptions{})
+	assert.Error(err)
+	assert.Empty(rowErrors)
+	assert.Len(rows, 1)
+}
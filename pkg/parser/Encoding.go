@@ -0,0 +1,101 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+)
+
+// encodings of the data files, EBCDIC is IBM code page 037
+const (
+	EncodingUTF8       = "utf-8"
+	EncodingShiftJIS   = "shift_jis"
+	EncodingEUCJP      = "euc-jp"
+	EncodingLatin1     = "latin-1"
+	EncodingEBCDIC     = "ebcdic"
+	EncodingEBCDIC037  = "cp037"
+	EncodingEBCDIC1047 = "cp1047"
+)
+
+// ebcdic newline and line feed, a line ends on either
+const (
+	ebcdicNL = 0x15
+	ebcdicLF = 0x25
+	ebcdicCR = 0x0d
+)
+
+type sourceEncoding struct {
+	encoding encoding.Encoding
+	split    bufio.SplitFunc
+	// lineEnds are the bytes split ends a line on
+	lineEnds []byte
+}
+
+var (
+	asciiLineEnds  = []byte{'\n'}
+	ebcdicLineEnds = []byte{ebcdicNL, ebcdicLF}
+)
+
+// CheckEncoding returns an error when name is not a known encoding
+func CheckEncoding(name string) error {
+	_, err := lookupEncoding(name)
+	return err
+}
+
+func lookupEncoding(name string) (*sourceEncoding, error) {
+	switch strings.ToLower(name) {
+	case "", EncodingUTF8, "utf8":
+		return &sourceEncoding{split: bufio.ScanLines, lineEnds: asciiLineEnds}, nil
+	case EncodingShiftJIS, "sjis", "shift-jis", "cp932":
+		return &sourceEncoding{encoding: japanese.ShiftJIS, split: bufio.ScanLines, lineEnds: asciiLineEnds}, nil
+	case EncodingEUCJP, "eucjp":
+		return &sourceEncoding{encoding: japanese.EUCJP, split: bufio.ScanLines, lineEnds: asciiLineEnds}, nil
+	case EncodingLatin1, "latin1", "iso-8859-1":
+		return &sourceEncoding{encoding: charmap.ISO8859_1, split: bufio.ScanLines, lineEnds: asciiLineEnds}, nil
+	case EncodingEBCDIC, EncodingEBCDIC037, "ibm037":
+		return &sourceEncoding{encoding: charmap.CodePage037, split: scanEBCDICLines, lineEnds: ebcdicLineEnds}, nil
+	case EncodingEBCDIC1047, "ibm1047":
+		return &sourceEncoding{encoding: charmap.CodePage1047, split: scanEBCDICLines, lineEnds: ebcdicLineEnds}, nil
+	}
+	return nil, fmt.Errorf("unknown encoding %q", name)
+}
+
+// scanEBCDICLines is bufio.ScanLines with the EBCDIC line ends
+func scanEBCDICLines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	for i, b := range data {
+		if b == ebcdicNL || b == ebcdicLF {
+			return i + 1, bytes.TrimSuffix(data[:i], []byte{ebcdicCR}), nil
+		}
+	}
+	if atEOF {
+		return len(data), bytes.TrimSuffix(data, []byte{ebcdicCR}), nil
+	}
+	return 0, nil, nil
+}
+
+// singleByte is true when every character is one byte, so widths in runes
+// or columns are widths in bytes
+func (e *sourceEncoding) singleByte() bool {
+	_, ok := e.encoding.(*charmap.Charmap)
+	return ok
+}
+
+// decode returns raw as utf-8
+func (e *sourceEncoding) decode(raw []byte) (string, error) {
+	if e == nil || e.encoding == nil {
+		return string(raw), nil
+	}
+	decoded, err := e.encoding.NewDecoder().Bytes(raw)
+	if err != nil {
+		return "", fmt.Errorf("invalid %v data, %v", e.encoding, err)
+	}
+	return string(decoded), nil
+}
@@ -0,0 +1,179 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Layout is a record type of a spec of layouts, read with the spec of Model
+// when the discriminator field of a record is Code
+type Layout struct {
+	Code  string
+	Model string
+	Metas []*SQLMeta
+}
+
+// LayoutOption is a #layout=CODE:model line of a spec
+type LayoutOption struct {
+	Code  string
+	Model string
+}
+
+// errRecord is an error of the structure of a file, it stops the file even
+// when bad rows are rejected
+type errRecord struct {
+	error
+}
+
+func (o *SpecOptions) setLayout(key, value string) error {
+	switch key {
+	case "layout":
+		tokens := strings.SplitN(value, ":", 2)
+		if len(tokens) != 2 || tokens[0] == "" || tokens[1] == "" {
+			return fmt.Errorf("invalid layout %q, want CODE:model", value)
+		}
+		o.Layouts = append(o.Layouts, LayoutOption{Code: tokens[0], Model: tokens[1]})
+	case "discriminator":
+		tokens := strings.Split(value, ",")
+		if len(tokens) != 2 {
+			return fmt.Errorf("invalid discriminator %q, want start,width", value)
+		}
+		start, err := strconv.Atoi(strings.TrimSpace(tokens[0]))
+		if err != nil || start < 1 {
+			return fmt.Errorf("invalid discriminator %q, want start,width", value)
+		}
+		width, err := strconv.Atoi(strings.TrimSpace(tokens[1]))
+		if err != nil || width < 1 {
+			return fmt.Errorf("invalid discriminator %q, want start,width", value)
+		}
+		o.DiscriminatorStart, o.DiscriminatorWidth = start, width
+	case "header":
+		o.Header = value
+	case "trailer":
+		o.Trailer = value
+	case "trailer_count":
+		o.TrailerCount = value
+	}
+	return nil
+}
+
+// checkLayouts defaults the discriminator to the first character and checks
+// the header and trailer are layouts
+func (o *SpecOptions) checkLayouts() error {
+	if len(o.Layouts) == 0 {
+		if o.DiscriminatorStart > 0 || o.Header != "" || o.Trailer != "" || o.TrailerCount != "" {
+			return fmt.Errorf("discriminator, header or trailer without layout")
+		}
+		return nil
+	}
+	if o.DiscriminatorStart == 0 {
+		o.DiscriminatorStart, o.DiscriminatorWidth = 1, 1
+	}
+	codes := make(map[string]bool)
+	for _, layout := range o.Layouts {
+		if codes[layout.Code] {
+			return fmt.Errorf("layout %s is defined twice", layout.Code)
+		}
+		codes[layout.Code] = true
+	}
+	if o.Header != "" && !codes[o.Header] {
+		return fmt.Errorf("header %s is not a layout", o.Header)
+	}
+	if o.Trailer != "" && !codes[o.Trailer] {
+		return fmt.Errorf("trailer %s is not a layout", o.Trailer)
+	}
+	if o.TrailerCount != "" && o.Trailer == "" {
+		return fmt.Errorf("trailer_count without trailer")
+	}
+	return nil
+}
+
+// checkTrailerCount checks the trailer layout has the count field
+func checkTrailerCount(options SpecOptions, layouts []*Layout) error {
+	if options.TrailerCount == "" {
+		return nil
+	}
+	for _, layout := range layouts {
+		if layout.Code != options.Trailer {
+			continue
+		}
+		for _, meta := range layout.Metas {
+			if meta.Name != options.TrailerCount {
+				continue
+			}
+			switch meta.DataType {
+			case "INTEGER", "BIGINT":
+				return nil
+			}
+			return fmt.Errorf("trailer_count %s is not an INTEGER", meta.Name)
+		}
+	}
+	return fmt.Errorf("trailer_count %s is not a column of %s", options.TrailerCount, options.Trailer)
+}
+
+// readLayout returns the layout of a raw record
+func (ds *DataScanner) readLayout(raw []byte) (*Layout, error) {
+	if ds.trailer {
+		return nil, errRecord{fmt.Errorf("record after the trailer")}
+	}
+	discriminator := []*SQLMeta{
+		&SQLMeta{Size: ds.Options.DiscriminatorStart - 1},
+		&SQLMeta{Size: ds.Options.DiscriminatorWidth},
+	}
+	// a line too short for the discriminator has the empty code, matching
+	// no layout and neither an unset header nor an unset trailer
+	fields, err := ds.fields(raw, discriminator)
+	code := ""
+	if err == nil {
+		code = strings.TrimSpace(fields[1])
+	}
+	switch {
+	case ds.Options.Header != "" && code == ds.Options.Header:
+		if ds.line != 1 {
+			return nil, errRecord{fmt.Errorf("header record not first")}
+		}
+	case ds.Options.Trailer != "" && code == ds.Options.Trailer:
+		ds.trailer = true
+	default:
+		if ds.line == 1 && ds.Options.Header != "" {
+			return nil, errRecord{fmt.Errorf("no header record")}
+		}
+	}
+	for _, layout := range ds.Layouts {
+		if layout.Code == code {
+			return layout, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown record type %q", code)
+}
+
+// checkTrailer compares the count of the trailer row with the detail
+// records read
+func (ds *DataScanner) checkTrailer(row *Row) error {
+	if ds.Options.TrailerCount == "" {
+		return nil
+	}
+	var count int64
+	value, _ := row.Get(ds.Options.TrailerCount)
+	switch value := value.(type) {
+	case int:
+		count = int64(value)
+	case int64:
+		count = value
+	default:
+		return fmt.Errorf("trailer count %v is not a number", value)
+	}
+	if count != int64(ds.details) {
+		return fmt.Errorf("trailer count %d but %d detail records", count, ds.details)
+	}
+	return nil
+}
+
+// checkEnd is called at the end of the data
+func (ds *DataScanner) checkEnd() error {
+	if ds.Options.Trailer != "" && !ds.trailer {
+		return fmt.Errorf("no trailer record")
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package parser
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testLayoutOptions = SpecOptions{
+	Layouts: []LayoutOption{
+		{Code: "H", Model: "bank_header"},
+		{Code: "D", Model: "bank_detail"},
+		{Code: "T", Model: "bank_trailer"},
+	},
+	DiscriminatorStart: 1,
+	DiscriminatorWidth: 1,
+	Header:             "H",
+	Trailer:            "T",
+	TrailerCount:       "count",
+}
+
+var testLayouts = []*Layout{
+	&Layout{Code: "H", Model: "bank_header", Metas: []*SQLMeta{
+		&SQLMeta{Name: "type", Size: 1, DataType: "TEXT"},
+		&SQLMeta{Name: "day", Size: 8, DataType: "DATE"},
+	}},
+	&Layout{Code: "D", Model: "bank_detail", Metas: []*SQLMeta{
+		&SQLMeta{Name: "type", Size: 1, DataType: "TEXT"},
+		&SQLMeta{Name: "name", Size: 5, DataType: "TEXT"},
+		&SQLMeta{Name: "amount", Size: 4, DataType: "INTEGER"},
+	}},
+	&Layout{Code: "T", Model: "bank_trailer", Metas: []*SQLMeta{
+		&SQLMeta{Name: "type", Size: 1, DataType: "TEXT"},
+		&SQLMeta{Name: "count", Size: 6, DataType: "INTEGER"},
+	}},
+}
+
+func readLayouts(data string) ([]string, error) {
+	models, _, err := readLayoutsOptions(data, testLayoutOptions)
+	return models, err
+}
+
+// readLayoutsOptions also returns the errors of the rows to reject
+func readLayoutsOptions(data string, options SpecOptions) ([]string, []error, error) {
+	scanner := &DataScanner{
+		Layouts: testLayouts,
+		Scanner: bufio.NewScanner(strings.NewReader(data)),
+	}
+	scanner.SetOptions(options)
+	var models []string
+	var rowErrors []error
+	for {
+		_, haveData, err := scanner.ReadRow()
+		if !haveData {
+			return models, rowErrors, err
+		}
+		if err != nil {
+			models = append(models, "error")
+			rowErrors = append(rowErrors, err)
+			continue
+		}
+		models = append(models, scanner.Layout().Model)
+	}
+}
+
+func TestReadRowLayouts(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	models, err := readLayouts(`H20200329
+Dalice  12
+Dbob    34
+T000002`)
+	assert.Nil(err)
+	assert.Equal([]string{"bank_header", "bank_detail", "bank_detail", "bank_trailer"}, models)
+
+	// bad details are rows to reject, the trailer counts the rows loaded
+	models, err = readLayouts(`H20200329
+Dalice  12
+X
+Dbob    ab
+T000001`)
+	assert.Nil(err)
+	assert.Equal([]string{"bank_header", "bank_detail", "error", "error", "bank_trailer"}, models)
+
+	// a rejected detail is not loaded, so a count of every record fails
+	models, err = readLayouts(`H20200329
+Dalice  12
+Dbob    ab
+T000002`)
+	assert.EqualError(err, "trailer count 2 but 1 detail records")
+	assert.Equal([]string{"bank_header", "bank_detail", "error"}, models)
+}
+
+func TestReadRowLayoutsBlank(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	// without a header a blank line is a bad detail, not a second header
+	options := testLayoutOptions
+	options.Header = ""
+	models, rowErrors, err := readLayoutsOptions("Dalice  12\n\nDbob    34\nT000002", options)
+	assert.Nil(err)
+	assert.Equal([]string{"bank_detail", "error", "bank_detail", "bank_trailer"}, models)
+	if assert.Len(rowErrors, 1) {
+		assert.Contains(rowErrors[0].Error(), "unknown record type")
+	}
+
+	// without a trailer a blank line does not end the records
+	options = testLayoutOptions
+	options.Trailer = ""
+	options.TrailerCount = ""
+	models, rowErrors, err = readLayoutsOptions("H20200329\nDalice  12\n\nDbob    34", options)
+	assert.Nil(err)
+	assert.Equal([]string{"bank_header", "bank_detail", "error", "bank_detail"}, models)
+	if assert.Len(rowErrors, 1) {
+		assert.Contains(rowErrors[0].Error(), "unknown record type")
+	}
+}
+
+func TestReadRowLayoutsInvalid(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	files := []string{
+		// trailer count
+		"H20200329\nDalice  12\nT000002",
+		// no trailer
+		"H20200329\nDalice  12",
+		// record after the trailer
+		"H20200329\nDalice  12\nT000001\nDbob    34",
+		// no header
+		"Dalice  12\nT000001",
+		// header not first
+		"H20200329\nH20200329\nT000000",
+		// bad trailer
+		"H20200329\nDalice  12\nT0000x1",
+	}
+	for _, data := range files {
+		_, err := readLayouts(data)
+		assert.Error(err, data)
+	}
+}
+
+func TestParseLayoutOptions(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	parser := &SQLMetaCSVParser{
+		filePath: "TestParseLayoutOptions",
+		buffer: []byte(`#layout=H:bank_header
+#layout=D:bank_detail
+#layout=T:bank_trailer
+#header=H
+#trailer=T
+#trailer_count=count
+`),
+	}
+	metas, err := parser.Parse()
+	assert.Nil(err)
+	assert.Nil(metas)
+	assert.Equal(testLayoutOptions, parser.Options())
+
+	specs := []string{
+		"#layout=H\n",
+		"#layout=H:a\n#layout=H:b\n",
+		"#layout=H:a\n#trailer=T\n",
+		"#layout=H:a\n#trailer_count=count\n",
+		"#layout=H:a\n#discriminator=0,1\n",
+		"#trailer=T\nname,size,datatype\n",
+		"#layout=H:a\nname,size,datatype\n",
+		"#layout=H:a\n#record_length=spec\n",
+	}
+	for _, spec := range specs {
+		parser = &SQLMetaCSVParser{filePath: "TestParseLayoutOptions", buffer: []byte(spec)}
+		_, err = parser.Parse()
+		assert.Error(err, spec)
+	}
+}
+
+func TestMakeParserLayouts(t *testing.T) {
+	assert := assert.New(t)
+	dir, _ := ioutil.TempDir("", "TestMakeParserLayouts")
+	defer os.RemoveAll(dir)
+	specs := map[string]string{
+		"bank.csv":         "#layout=H:bank_header\n#layout=D:bank_detail\n#layout=T:bank_trailer\n#trailer=T\n#trailer_count=count\n",
+		"bank_header.csv":  "name,size,datatype\ntype,1,TEXT\nday,8,DATE\n",
+		"bank_detail.csv":  "name,size,datatype\ntype,1,TEXT\nname,5,TEXT\namount,4,INTEGER\n",
+		"bank_trailer.csv": "name,size,datatype\ntype,1,TEXT\ncount,6,INTEGER\n",
+		"nested.csv":       "#layout=B:bank\n",
+		"nocount.csv":      "#layout=H:bank_header\n#trailer=H\n#trailer_count=day\n",
+	}
+	for name, spec := range specs {
+		ioutil.WriteFile(filepath.Join(dir, name), []byte(spec), 0644)
+	}
+	factory := NewDataParserFactory(dir + string(filepath.Separator))
+	p, err := factory.MakeParser("bank")
+	assert.Nil(err)
+	assert.Len(p.Layouts(), 3)
+	assert.Equal("bank_detail", p.Layouts()[1].Model)
+	assert.Len(p.Layouts()[1].Metas, 3)
+	detail, _ := factory.MakeParser("bank_detail")
+	assert.NotEqual(detail.Version(), p.Version())
+
+	_, err = factory.MakeParser("nested")
+	assert.Error(err)
+	_, err = factory.MakeParser("nocount")
+	assert.Error(err)
+}
@@ -0,0 +1,59 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+)
+
+// recordLengthSpec is record_length=spec until the spec width is known
+const recordLengthSpec = -1
+
+// scanRecords splits fixed length records followed by terminator bytes of
+// line ends, like 2 for CRLF. The last record may miss its terminator and
+// line ends left at the end of the data are skipped.
+func scanRecords(length, terminator int, lineEnds []byte) bufio.SplitFunc {
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if atEOF && len(data) == 0 {
+			return 0, nil, nil
+		}
+		if len(data) >= length+terminator {
+			if !isLineEnd(data[length:length+terminator], lineEnds) {
+				return 0, nil, fmt.Errorf("record not followed by %d line end bytes", terminator)
+			}
+			return length + terminator, data[:length], nil
+		}
+		if !atEOF {
+			return 0, nil, nil
+		}
+		if isLineEnd(data, lineEnds) {
+			return len(data), nil, nil
+		}
+		if len(data) >= length && isLineEnd(data[length:], lineEnds) {
+			return len(data), data[:length], nil
+		}
+		return 0, nil, fmt.Errorf("incomplete record of %d bytes", len(data))
+	}
+}
+
+// isLineEnd is true when data is only carriage returns and the lineEnds of
+// the source encoding, CR is the same byte in ascii and ebcdic
+func isLineEnd(data, lineEnds []byte) bool {
+	for _, b := range data {
+		if b != '\r' && bytes.IndexByte(lineEnds, b) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// checkRecordUnit refuses fixed length records of a multibyte encoding
+// unless the widths count bytes: records are cut by bytes, so a field of
+// runes or columns holding a multibyte character would shift every record
+// after it
+func (o SpecOptions) checkRecordUnit(source *sourceEncoding) error {
+	if o.RecordLength == 0 || o.WidthUnit == WidthBytes || source.singleByte() {
+		return nil
+	}
+	return fmt.Errorf("record_length of a multibyte encoding without width_unit=bytes")
+}
@@ -0,0 +1,73 @@
+package parser
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func scanAll(data string, length, terminator int) ([]string, error) {
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	scanner.Split(scanRecords(length, terminator, asciiLineEnds))
+	var records []string
+	for scanner.Scan() {
+		records = append(records, scanner.Text())
+	}
+	return records, scanner.Err()
+}
+
+func TestScanRecords(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	cases := []struct {
+		data       string
+		length     int
+		terminator int
+	}{
+		{"abcdefghi", 3, 0},
+		{"abcdefghi\n", 3, 0},
+		{"abc\r\ndef\r\nghi\r\n", 3, 2},
+		{"abc\r\ndef\r\nghi", 3, 2},
+		{"abc\ndef\nghi\n", 3, 1},
+	}
+	for _, c := range cases {
+		records, err := scanAll(c.data, c.length, c.terminator)
+		assert.Nil(err, c.data)
+		assert.Equal([]string{"abc", "def", "ghi"}, records, c.data)
+	}
+}
+
+func TestScanRecordsInvalid(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	records, err := scanAll("abcdefgh", 3, 0)
+	assert.Equal([]string{"abc", "def"}, records)
+	assert.Error(err)
+
+	records, err = scanAll("abc\r\ndefX\r\n", 3, 2)
+	assert.Equal([]string{"abc"}, records)
+	assert.Error(err)
+
+	// the ebcdic line feed is a % in ascii
+	records, err = scanAll("abc\ndef%ghi\n", 3, 1)
+	assert.Equal([]string{"abc"}, records)
+	assert.Error(err)
+	records, err = scanAll("abc\ndef%%", 3, 1)
+	assert.Equal([]string{"abc"}, records)
+	assert.Error(err)
+}
+
+func TestScanRecordsEBCDIC(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	scanner := bufio.NewScanner(strings.NewReader("abc\x25def\x15ghi\x0d\x25"))
+	scanner.Split(scanRecords(3, 1, ebcdicLineEnds))
+	var records []string
+	for scanner.Scan() {
+		records = append(records, scanner.Text())
+	}
+	assert.Nil(scanner.Err())
+	assert.Equal([]string{"abc", "def", "ghi"}, records)
+}
@@ -0,0 +1,42 @@
+package parser
+
+// Row is a record read with the metas of its record type, Values[i] is the
+// value of Metas[i]. Rows of the same spec share their Metas.
+type Row struct {
+	Metas  []*SQLMeta
+	Values []interface{}
+}
+
+// NewRow returns a row of metas without values
+func NewRow(metas []*SQLMeta) *Row {
+	return &Row{Metas: metas, Values: make([]interface{}, len(metas))}
+}
+
+// Get returns the value of the named column, ok is false when the row has
+// no such column
+func (r *Row) Get(name string) (interface{}, bool) {
+	for i, meta := range r.Metas {
+		if meta.Name == name {
+			return r.Values[i], true
+		}
+	}
+	return nil, false
+}
+
+// Map returns the values by column name
+func (r *Row) Map() map[string]interface{} {
+	values := make(map[string]interface{}, len(r.Metas))
+	for i, meta := range r.Metas {
+		values[meta.Name] = r.Values[i]
+	}
+	return values
+}
+
+// Columns are the names of the metas of the row, in spec order
+func (r *Row) Columns() []string {
+	columns := make([]string, len(r.Metas))
+	for i, meta := range r.Metas {
+		columns[i] = meta.Name
+	}
+	return columns
+}
@@ -1,6 +1,8 @@
 package parser
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io/ioutil"
 	"strconv"
@@ -10,14 +12,85 @@ import (
 type SQLMetaCSVParser struct {
 	filePath string
 	buffer   []byte
+	options  SpecOptions
 }
 
+// SpecOptions are the settings of a whole spec, given as #key=value lines
+// before the header like #width_unit=bytes
+type SpecOptions struct {
+	// WidthUnit is what the widths count, WidthRunes by default
+	WidthUnit string
+	// Encoding of the data files, EncodingUTF8 by default
+	Encoding string
+	// RecordLength reads records of this many bytes instead of lines, a
+	// length over the spec width is padding after the fields
+	RecordLength int
+	// RecordTerminator is the bytes of line end after every record
+	RecordTerminator int
+	// MaxRecordLength is the longest line or record read in bytes,
+	// DefaultMaxRecordLength when 0
+	MaxRecordLength int
+	// Layouts make a spec of several record types, told apart by the
+	// discriminator field of DiscriminatorWidth from DiscriminatorStart (1)
+	Layouts            []LayoutOption
+	DiscriminatorStart int
+	DiscriminatorWidth int
+	// Header and Trailer are the codes of the first and last records,
+	// TrailerCount the field of the trailer counting the records between
+	Header       string
+	Trailer      string
+	TrailerCount string
+	// Format is FormatFixed (default) or FormatDelimited, a delimited file
+	// is split on Delimiter (,) and quoted as csv unless NoQuote. Its first
+	// record names the columns unless Headerless.
+	Format     string
+	Delimiter  string
+	NoQuote    bool
+	Headerless bool
+}
+
+// width units, runes for utf-8 feeds, bytes for feeds of a multibyte
+// encoding and columns for feeds padded on the display width of East Asian
+// wide characters
+const (
+	WidthRunes   = "runes"
+	WidthBytes   = "bytes"
+	WidthColumns = "columns"
+)
+
 type SQLMeta struct {
 	Name     string
 	Size     int
 	DataType string
+	// Format is the go time layout of DATE and TIMESTAMP columns
+	Format string
+	// Scale is the digits after the decimal point of DECIMAL columns
+	Scale int
+	// Implied means the decimal point is not in the data, only in the scale
+	Implied bool
+	// Sign is how numeric columns carry their sign, see SignOverpunch
+	Sign string
+	// Nullable columns read as NULL when the field matches NullValues
+	Nullable   bool
+	NullValues []string
+	// Extra is a column the loader adds outside the spec, like the lineage
+	// or a group of the file name, a migration never drops it
+	Extra bool
 }
 
+// default layouts when a DATE or TIMESTAMP column has no format
+const (
+	DefaultDateFormat      = "20060102"
+	DefaultTimestampFormat = "20060102150405"
+)
+
+// null sentinels matching a blank field and a field of only zeros,
+// any other null value is compared with the trimmed field
+const (
+	NullSpaces = "SPACES"
+	NullZeros  = "ZEROS"
+)
+
 func NewSQLMetaCSVParser(filePath string) (*SQLMetaCSVParser, error) {
 	buffer, err := ioutil.ReadFile(filePath)
 	if err != nil {
@@ -29,17 +102,54 @@ func NewSQLMetaCSVParser(filePath string) (*SQLMetaCSVParser, error) {
 	}, nil
 }
 
+// Parse reads the spec. The first three columns are always name, size and
+// datatype; any further columns are optional attributes named by the header.
 func (p *SQLMetaCSVParser) Parse() ([]*SQLMeta, error) {
 	var err error
 	var output []*SQLMeta
 
 	lines := strings.Split(string(p.buffer), "\n")
-	for i, line := range lines[1:] {
+	start := 0
+	for ; start < len(lines) && strings.HasPrefix(lines[start], "#"); start++ {
+		err = p.options.set(strings.TrimRight(lines[start][1:], "\r"))
+		if err != nil {
+			return nil, fmt.Errorf("Fail to parse %s in line %d: %v", p.filePath, start, err)
+		}
+	}
+	err = p.options.checkFormat()
+	if err == nil {
+		err = p.options.checkLayouts()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Fail to parse %s: %v", p.filePath, err)
+	}
+	if len(p.options.Layouts) > 0 {
+		// the columns are in the spec of every layout
+		for _, line := range lines[start:] {
+			if strings.TrimSpace(line) != "" {
+				return nil, fmt.Errorf("Fail to parse %s: columns in a spec of layouts", p.filePath)
+			}
+		}
+		err = p.options.checkRecord(nil)
+		if err != nil {
+			return nil, fmt.Errorf("Fail to parse %s: %v", p.filePath, err)
+		}
+		return nil, nil
+	}
+	if start == len(lines) {
+		return nil, fmt.Errorf("Fail to parse %s header", p.filePath)
+	}
+	header := parseHeader(lines[start])
+	if len(header) < 3 {
+		return nil, fmt.Errorf("Fail to parse %s header", p.filePath)
+	}
+	for i, line := range lines[start+1:] {
+		line = strings.TrimRight(line, "\r")
 		if len(line) == 0 {
 			continue
 		}
 		tokens := strings.Split(line, ",")
-		if len(tokens) != 3 {
+		if len(tokens) != len(header) {
 			return nil, fmt.Errorf("Fail to parse %s in line %d", p.filePath, i)
 		}
 		var size int
@@ -47,11 +157,208 @@ func (p *SQLMetaCSVParser) Parse() ([]*SQLMeta, error) {
 		if err != nil {
 			return nil, fmt.Errorf("Fail to parse %s in line %d", p.filePath, i)
 		}
-		output = append(output, &SQLMeta{
+		meta := &SQLMeta{
 			Name:     tokens[0],
 			Size:     size,
-			DataType: tokens[2],
-		})
+			DataType: strings.ToUpper(tokens[2]),
+		}
+		for j, attr := range header[3:] {
+			err = meta.setAttribute(attr, tokens[j+3])
+			if err != nil {
+				return nil, fmt.Errorf("Fail to parse %s in line %d: %v", p.filePath, i, err)
+			}
+		}
+		if meta.Scale > meta.Size {
+			return nil, fmt.Errorf("Fail to parse %s in line %d: scale %d over the size %d of %s", p.filePath, i, meta.Scale, meta.Size, meta.Name)
+		}
+		if len(meta.NullValues) > 0 && !meta.Nullable {
+			return nil, fmt.Errorf("Fail to parse %s in line %d: null_if on not nullable %s", p.filePath, i, meta.Name)
+		}
+		if meta.Nullable && len(meta.NullValues) == 0 {
+			meta.NullValues = []string{NullSpaces}
+		}
+		output = append(output, meta)
+	}
+	err = p.options.checkRecord(output)
+	if err != nil {
+		return nil, fmt.Errorf("Fail to parse %s: %v", p.filePath, err)
 	}
 	return output, nil
 }
+
+// Options are the spec options read by Parse
+func (p *SQLMetaCSVParser) Options() SpecOptions {
+	return p.options
+}
+
+// Version is the sha256 of the spec, it changes whenever the spec changes
+func (p *SQLMetaCSVParser) Version() string {
+	sum := sha256.Sum256(p.buffer)
+	return hex.EncodeToString(sum[:])
+}
+
+func parseHeader(line string) []string {
+	var header []string
+	for _, token := range strings.Split(strings.TrimRight(line, "\r"), ",") {
+		token = strings.ToLower(strings.Trim(strings.TrimSpace(token), `"`))
+		header = append(header, strings.Replace(token, " ", "_", -1))
+	}
+	return header
+}
+
+func (meta *SQLMeta) setAttribute(attr, value string) error {
+	var err error
+	switch attr {
+	case "format":
+		meta.Format = value
+	case "scale":
+		if value == "" {
+			return nil
+		}
+		meta.Scale, err = strconv.Atoi(value)
+		if err != nil || meta.Scale < 0 {
+			return fmt.Errorf("invalid scale %q", value)
+		}
+	case "implied_scale":
+		if value == "" {
+			return nil
+		}
+		meta.Scale, err = strconv.Atoi(value)
+		if err != nil || meta.Scale < 0 {
+			return fmt.Errorf("invalid implied_scale %q", value)
+		}
+		meta.Implied = true
+	case "sign":
+		meta.Sign = strings.ToUpper(value)
+		switch meta.Sign {
+		case "", SignLeading, SignTrailing, SignOverpunch, SignLeadingOverpunch:
+		default:
+			return fmt.Errorf("unknown sign %q", value)
+		}
+	case "nullable":
+		switch strings.ToUpper(value) {
+		case "Y", "YES", "TRUE", "1":
+			meta.Nullable = true
+		case "", "N", "NO", "FALSE", "0":
+			meta.Nullable = false
+		default:
+			return fmt.Errorf("invalid nullable %q", value)
+		}
+	case "null_if":
+		if value == "" {
+			return nil
+		}
+		meta.NullValues = strings.Split(value, "|")
+	default:
+		return fmt.Errorf("unknown attribute %s", attr)
+	}
+	return nil
+}
+
+func (o *SpecOptions) set(directive string) error {
+	tokens := strings.SplitN(directive, "=", 2)
+	if len(tokens) != 2 {
+		return fmt.Errorf("invalid option %q", directive)
+	}
+	key, value := strings.ToLower(strings.TrimSpace(tokens[0])), strings.TrimSpace(tokens[1])
+	switch key {
+	case "width_unit":
+		o.WidthUnit = strings.ToLower(value)
+		switch o.WidthUnit {
+		case WidthRunes, WidthBytes, WidthColumns:
+		default:
+			return fmt.Errorf("unknown width_unit %q", value)
+		}
+	case "record_length":
+		if strings.ToLower(value) == "spec" {
+			o.RecordLength = recordLengthSpec
+			return nil
+		}
+		length, err := strconv.Atoi(value)
+		if err != nil || length < 1 {
+			return fmt.Errorf("invalid record_length %q", value)
+		}
+		o.RecordLength = length
+	case "record_terminator":
+		length, err := strconv.Atoi(value)
+		if err != nil || length < 0 {
+			return fmt.Errorf("invalid record_terminator %q", value)
+		}
+		o.RecordTerminator = length
+	case "max_record_length":
+		length, err := strconv.Atoi(value)
+		if err != nil || length < 1 {
+			return fmt.Errorf("invalid max_record_length %q", value)
+		}
+		o.MaxRecordLength = length
+	case "layout", "discriminator", "header", "trailer", "trailer_count":
+		return o.setLayout(key, value)
+	case "format":
+		o.Format = strings.ToLower(value)
+		switch o.Format {
+		case FormatFixed, FormatDelimited:
+		default:
+			return fmt.Errorf("unknown format %q", value)
+		}
+	case "delimiter":
+		switch strings.ToLower(value) {
+		case "tab", `\t`:
+			value = "\t"
+		case "pipe":
+			value = "|"
+		case "comma":
+			value = ","
+		}
+		if len([]rune(value)) != 1 || value == `"` || value == "\n" || value == "\r" {
+			return fmt.Errorf("invalid delimiter %q", value)
+		}
+		o.Delimiter = value
+	case "quote":
+		switch strings.ToLower(value) {
+		case `"`, "double":
+			o.NoQuote = false
+		case "none":
+			o.NoQuote = true
+		default:
+			return fmt.Errorf("invalid quote %q, want \" or none", value)
+		}
+	case "has_header":
+		has, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid has_header %q", value)
+		}
+		o.Headerless = !has
+	case "encoding":
+		if _, err := lookupEncoding(value); err != nil {
+			return err
+		}
+		o.Encoding = value
+	default:
+		return fmt.Errorf("unknown option %s", key)
+	}
+	return nil
+}
+
+// checkRecord resolves record_length=spec to the spec width and checks a
+// record holds every field
+func (o *SpecOptions) checkRecord(metas []*SQLMeta) error {
+	width := 0
+	for _, meta := range metas {
+		width += meta.Size
+	}
+	switch {
+	case o.RecordLength == recordLengthSpec && width == 0:
+		return fmt.Errorf("record_length=spec without columns")
+	case o.RecordLength == recordLengthSpec:
+		o.RecordLength = width
+	case o.RecordLength == 0 && o.RecordTerminator > 0:
+		return fmt.Errorf("record_terminator without record_length")
+	case o.RecordLength > 0 && o.RecordLength < width:
+		return fmt.Errorf("record_length %d under the spec width %d", o.RecordLength, width)
+	}
+	source, err := lookupEncoding(o.Encoding)
+	if err != nil {
+		return err
+	}
+	return o.checkRecordUnit(source)
+}
@@ -67,3 +67,186 @@ func TestParseFail(t *testing.T) {
 	_, err := parser.Parse()
 	assert.Error(err)
 }
+
+func TestParseAttributes(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	parser := &SQLMetaCSVParser{
+		filePath: "TestParseAttributes",
+		buffer: []byte(`"column name",width,datatype,format,scale
+day,10,DATE,2006-01-02,
+amount,9,decimal,,2
+`),
+	}
+	meta, err := parser.Parse()
+	assert.Nil(err)
+	assert.Equal(meta, []*SQLMeta{
+		&SQLMeta{
+			Name:     "day",
+			Size:     10,
+			DataType: "DATE",
+			Format:   "2006-01-02",
+		},
+		&SQLMeta{
+			Name:     "amount",
+			Size:     9,
+			DataType: "DECIMAL",
+			Scale:    2,
+		},
+	})
+}
+
+func TestParseUnknownAttribute(t *testing.T) {
+	t.Parallel()
+	parser := &SQLMetaCSVParser{
+		filePath: "TestParseUnknownAttribute",
+		buffer: []byte(`"column name",width,datatype,colour
+name,10,TEXT,red`),
+	}
+	_, err := parser.Parse()
+	assert.Error(t, err)
+}
+
+func TestParseSignAttributes(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	parser := &SQLMetaCSVParser{
+		filePath: "TestParseSignAttributes",
+		buffer: []byte(`"column name",width,datatype,implied_scale,sign
+amount,7,DECIMAL,2,overpunch
+count,4,INTEGER,,TRAILING`),
+	}
+	meta, err := parser.Parse()
+	assert.Nil(err)
+	assert.Equal(meta, []*SQLMeta{
+		&SQLMeta{
+			Name:     "amount",
+			Size:     7,
+			DataType: "DECIMAL",
+			Scale:    2,
+			Implied:  true,
+			Sign:     SignOverpunch,
+		},
+		&SQLMeta{
+			Name:     "count",
+			Size:     4,
+			DataType: "INTEGER",
+			Sign:     SignTrailing,
+		},
+	})
+
+	parser.buffer = []byte(`"column name",width,datatype,sign
+amount,7,DECIMAL,sideways`)
+	_, err = parser.Parse()
+	assert.Error(err)
+}
+
+func TestParseScaleOverSize(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	parser := &SQLMetaCSVParser{
+		filePath: "TestParseScaleOverSize",
+		buffer: []byte(`"column name",width,datatype,implied_scale
+amount,2,DECIMAL,3`),
+	}
+	_, err := parser.Parse()
+	assert.Error(err)
+
+	parser.buffer = []byte(`"column name",width,datatype,scale
+amount,4,DECIMAL,5`)
+	_, err = parser.Parse()
+	assert.Error(err)
+
+	parser.buffer = []byte(`"column name",width,datatype,implied_scale
+amount,3,DECIMAL,3`)
+	_, err = parser.Parse()
+	assert.Nil(err)
+}
+
+func TestParseNullable(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	parser := &SQLMetaCSVParser{
+		filePath: "TestParseNullable",
+		buffer: []byte(`"column name",width,datatype,nullable,null_if
+name,10,TEXT,N,
+count,5,INTEGER,Y,
+day,8,DATE,Y,ZEROS|N/A`),
+	}
+	meta, err := parser.Parse()
+	assert.Nil(err)
+	assert.Equal(meta, []*SQLMeta{
+		&SQLMeta{Name: "name", Size: 10, DataType: "TEXT"},
+		&SQLMeta{Name: "count", Size: 5, DataType: "INTEGER", Nullable: true, NullValues: []string{NullSpaces}},
+		&SQLMeta{Name: "day", Size: 8, DataType: "DATE", Nullable: true, NullValues: []string{NullZeros, "N/A"}},
+	})
+
+	parser.buffer = []byte(`"column name",width,datatype,nullable,null_if
+name,10,TEXT,N,N/A`)
+	_, err = parser.Parse()
+	assert.Error(err)
+}
+
+func TestVersion(t *testing.T) {
+	t.Parallel()
+	parser := &SQLMetaCSVParser{buffer: []byte(`"column name",width,datatype`)}
+	other := &SQLMetaCSVParser{buffer: []byte(`"column name",width,datatype
+name,10,TEXT`)}
+	assert.Len(t, parser.Version(), 64)
+	assert.NotEqual(t, parser.Version(), other.Version())
+}
+
+func TestParseOptions(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	parser := &SQLMetaCSVParser{
+		filePath: "TestParseOptions",
+		buffer: []byte(`#width_unit=COLUMNS
+#encoding=shift_jis
+"column_name","size","datatype"
+名前,10,TEXT`),
+	}
+	meta, err := parser.Parse()
+	assert.Nil(err)
+	assert.Len(meta, 1)
+	assert.Equal(SpecOptions{WidthUnit: WidthColumns, Encoding: EncodingShiftJIS}, parser.Options())
+
+	for _, spec := range []string{"#width_unit=words\nname,size,datatype", "#speed=fast\nname,size,datatype", "#encoding=klingon\nname,size,datatype", "#width_unit"} {
+		parser = &SQLMetaCSVParser{filePath: "TestParseOptions", buffer: []byte(spec)}
+		_, err = parser.Parse()
+		assert.Error(err, spec)
+	}
+}
+
+func TestParseRecordOptions(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	spec := `"column_name","size","datatype"
+name,10,TEXT
+count,5,INTEGER`
+	parser := &SQLMetaCSVParser{
+		filePath: "TestParseRecordOptions",
+		buffer:   []byte("#width_unit=bytes\n#record_length=spec\n#record_terminator=2\n" + spec),
+	}
+	_, err := parser.Parse()
+	assert.Nil(err)
+	assert.Equal(SpecOptions{WidthUnit: WidthBytes, RecordLength: 15, RecordTerminator: 2}, parser.Options())
+
+	// a character of a single byte encoding is a byte
+	parser = &SQLMetaCSVParser{filePath: "TestParseRecordOptions", buffer: []byte("#encoding=latin-1\n#record_length=20\n" + spec)}
+	_, err = parser.Parse()
+	assert.Nil(err)
+	assert.Equal(20, parser.Options().RecordLength)
+
+	parser = &SQLMetaCSVParser{filePath: "TestParseRecordOptions", buffer: []byte("#max_record_length=1048576\n" + spec)}
+	_, err = parser.Parse()
+	assert.Nil(err)
+	assert.Equal(1048576, parser.Options().MaxRecordLength)
+
+	// runes of utf-8 or shift_jis are not bytes
+	for _, options := range []string{"#record_length=spec\n", "#width_unit=columns\n#encoding=shift_jis\n#record_length=20\n", "#width_unit=bytes\n#record_length=10\n", "#record_terminator=1\n", "#record_length=-3\n", "#max_record_length=0\n", "#max_record_length=1MB\n"} {
+		parser = &SQLMetaCSVParser{filePath: "TestParseRecordOptions", buffer: []byte(options + spec)}
+		_, err = parser.Parse()
+		assert.Error(err, options)
+	}
+}
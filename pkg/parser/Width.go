@@ -0,0 +1,68 @@
+package parser
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"golang.org/x/text/width"
+)
+
+// splitFields cuts a record into the fields of metas, the sizes counted in
+// unit
+func splitFields(row string, metas []*SQLMeta, unit string) ([]string, error) {
+	fields := make([]string, len(metas))
+	pos := 0
+	for i, meta := range metas {
+		end, err := fieldEnd(row, pos, meta.Size, unit)
+		if err != nil {
+			return nil, err
+		}
+		fields[i] = row[pos:end]
+		pos = end
+	}
+	return fields, nil
+}
+
+// fieldEnd returns the byte offset of the end of a field of size starting
+// at pos
+func fieldEnd(row string, pos, size int, unit string) (int, error) {
+	switch unit {
+	case WidthBytes:
+		if len(row)-pos < size {
+			return 0, fmt.Errorf("not enough length of data")
+		}
+		return pos + size, nil
+	case WidthColumns:
+		columns := 0
+		for columns < size {
+			if pos >= len(row) {
+				return 0, fmt.Errorf("not enough length of data")
+			}
+			r, n := utf8.DecodeRuneInString(row[pos:])
+			columns += runeColumns(r)
+			pos += n
+		}
+		if columns > size {
+			return 0, fmt.Errorf("wide character across the end of a field")
+		}
+		return pos, nil
+	}
+	for ; size > 0; size-- {
+		if pos >= len(row) {
+			return 0, fmt.Errorf("not enough length of data")
+		}
+		_, n := utf8.DecodeRuneInString(row[pos:])
+		pos += n
+	}
+	return pos, nil
+}
+
+// runeColumns is the display width of r, two for East Asian wide and
+// fullwidth characters
+func runeColumns(r rune) int {
+	switch width.LookupRune(r).Kind() {
+	case width.EastAsianWide, width.EastAsianFullwidth:
+		return 2
+	}
+	return 1
+}
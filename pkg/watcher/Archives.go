@@ -0,0 +1,65 @@
+package watcher
+
+import (
+	"data_play/pkg/parser"
+	"path/filepath"
+	"sync"
+)
+
+// Archives is shared by the watchers of several jobs reading the same
+// directory. An archive with members of several jobs is moved by the last
+// of them done with it, to the failed dir when any of them failed it.
+type Archives struct {
+	patterns []string
+
+	mutex   sync.Mutex
+	pending map[string]*pendingArchive
+}
+
+type pendingArchive struct {
+	left   map[string]bool
+	failed bool
+}
+
+// NewArchives shares the archives of the watchers of patterns
+func NewArchives(patterns ...string) *Archives {
+	return &Archives{
+		patterns: patterns,
+		pending:  make(map[string]*pendingArchive),
+	}
+}
+
+// finish records that the watcher of pattern is done with archive, last is
+// true once every pattern with members in it is done
+func (a *Archives) finish(archive, pattern string, loadErr error) (last bool, failed bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	pending, ok := a.pending[archive]
+	if !ok {
+		pending = &pendingArchive{left: make(map[string]bool)}
+		for _, other := range a.patterns {
+			if hasMembers(archive, other) {
+				pending.left[other] = true
+			}
+		}
+		a.pending[archive] = pending
+	}
+	delete(pending.left, pattern)
+	pending.failed = pending.failed || loadErr != nil
+	if len(pending.left) > 0 {
+		return false, pending.failed
+	}
+	delete(a.pending, archive)
+	return true, pending.failed
+}
+
+// hasMembers is true when archive is next to the files of pattern and has
+// members matching it
+func hasMembers(archive, pattern string) bool {
+	next, err := filepath.Match(filepath.Join(filepath.Dir(pattern), "*"+parser.ExtArchive), archive)
+	if err != nil || !next {
+		return false
+	}
+	members, err := parser.ArchiveMembers(archive, filepath.Base(pattern))
+	return err == nil && len(members) > 0
+}
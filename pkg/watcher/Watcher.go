@@ -0,0 +1,253 @@
+package watcher
+
+import (
+	"context"
+	"data_play/pkg/parser"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// default folders, next to the data file, of the files done with
+const (
+	DefaultProcessedDir = "processed"
+	DefaultFailedDir    = "failed"
+)
+
+// Watcher polls a glob for data files and hands out the ones fully written,
+// their compressed files and the zip archives next to them with members
+// matching the glob included.
+// With a Marker a file is ready once <file><Marker> exists, like
+// sample_1.txt.done; without one it is ready when its size and mod time did
+// not change between two polls.
+type Watcher struct {
+	Pattern string
+	Marker  string
+	// ProcessedDir and FailedDir receive the files once loaded, a relative
+	// dir is taken from the directory of the file
+	ProcessedDir string
+	FailedDir    string
+	// Archives, when the watchers of other jobs share the directory, leaves
+	// an archive in place until all the jobs with members in it are done
+	Archives *Archives
+
+	mutex sync.Mutex
+	seen  map[string]fileState
+	busy  map[string]bool
+	// kept are the archives done with but left to the other jobs, skipped
+	// the archives without members matching Pattern
+	kept    map[string]bool
+	skipped map[string]fileState
+}
+
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+func NewWatcher(pattern, marker string) *Watcher {
+	return &Watcher{
+		Pattern:      pattern,
+		Marker:       marker,
+		ProcessedDir: DefaultProcessedDir,
+		FailedDir:    DefaultFailedDir,
+		seen:         make(map[string]fileState),
+		busy:         make(map[string]bool),
+		kept:         make(map[string]bool),
+		skipped:      make(map[string]fileState),
+	}
+}
+
+// Ready returns the files ready since the last call. A file is only
+// returned once until Done is called on it.
+func (w *Watcher) Ready() ([]string, error) {
+	var matches []string
+	for _, glob := range parser.InputGlobs(w.Pattern) {
+		globMatches, err := filepath.Glob(glob)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, globMatches...)
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for file := range w.kept {
+		// moved by the last job done with it
+		if _, err := os.Stat(file); err != nil {
+			delete(w.kept, file)
+		}
+	}
+
+	var ready []string
+	seen := make(map[string]fileState)
+	skipped := make(map[string]fileState)
+	listed := make(map[string]bool)
+	for _, match := range matches {
+		if listed[match] {
+			continue
+		}
+		listed[match] = true
+		if w.Marker != "" && strings.HasSuffix(match, w.Marker) {
+			continue
+		}
+		if w.busy[match] || w.kept[match] {
+			continue
+		}
+		info, err := os.Stat(match)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		state := fileState{size: info.Size(), modTime: info.ModTime()}
+		if last, ok := w.skipped[match]; ok && last == state {
+			skipped[match] = state
+			continue
+		}
+		if w.Marker != "" {
+			if _, err = os.Stat(match + w.Marker); err == nil {
+				ready = append(ready, match)
+			}
+			continue
+		}
+		if last, ok := w.seen[match]; ok && last == state {
+			ready = append(ready, match)
+			continue
+		}
+		seen[match] = state
+	}
+	w.seen = seen
+
+	// an archive of other jobs only is left alone
+	matched := ready[:0]
+	for _, file := range ready {
+		if w.isArchive(file) && !hasMembers(file, w.Pattern) {
+			if info, err := os.Stat(file); err == nil {
+				skipped[file] = fileState{size: info.Size(), modTime: info.ModTime()}
+			}
+			continue
+		}
+		matched = append(matched, file)
+	}
+	ready = matched
+	w.skipped = skipped
+	for _, file := range ready {
+		w.busy[file] = true
+	}
+	return ready, nil
+}
+
+// Done moves a file handed out by Ready, with its marker, to ProcessedDir or
+// to FailedDir when loadErr is set. With Archives, an archive stays in place
+// until the last job with members in it is done.
+func (w *Watcher) Done(file string, loadErr error) error {
+	if w.Archives != nil && w.isArchive(file) {
+		last, failed := w.Archives.finish(file, w.Pattern, loadErr)
+		if !last {
+			w.mutex.Lock()
+			delete(w.busy, file)
+			w.kept[file] = true
+			w.mutex.Unlock()
+			return nil
+		}
+		if failed && loadErr == nil {
+			loadErr = fmt.Errorf("Archive %s failed for another job", file)
+		}
+	}
+	dir := w.ProcessedDir
+	if loadErr != nil {
+		dir = w.FailedDir
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(filepath.Dir(file), dir)
+	}
+	err := os.MkdirAll(dir, 0755)
+	if err == nil {
+		err = os.Rename(file, filepath.Join(dir, filepath.Base(file)))
+	}
+	if err != nil {
+		// keep it busy, loading it again would only fail the same way
+		return fmt.Errorf("Fail to move %s to %s, %v", file, dir, err)
+	}
+	if w.Marker != "" {
+		os.Rename(file+w.Marker, filepath.Join(dir, filepath.Base(file)+w.Marker))
+	}
+	w.mutex.Lock()
+	delete(w.busy, file)
+	w.mutex.Unlock()
+	return nil
+}
+
+// Run polls every interval and calls run on the ready files with a pool of
+// workers, until cancelContext is done
+func (w *Watcher) Run(cancelContext context.Context, interval time.Duration, workers int, run func(context.Context, string) error) {
+	var wg sync.WaitGroup
+	jobChan := make(chan string)
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range jobChan {
+				err := run(cancelContext, file)
+				if err != nil {
+					fmt.Println(err)
+				}
+				if cancelContext.Err() != nil {
+					// interrupted, leave the file for the next start
+					w.release(file)
+					continue
+				}
+				if err = w.Done(file, err); err != nil {
+					fmt.Println(err)
+				}
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+pollloop:
+	for {
+		ready, err := w.Ready()
+		if err != nil {
+			fmt.Println(err)
+		}
+		for i, file := range ready {
+			select {
+			case <-cancelContext.Done():
+				for _, file := range ready[i:] {
+					w.release(file)
+				}
+				break pollloop
+			case jobChan <- file:
+			}
+		}
+		select {
+		case <-cancelContext.Done():
+			break pollloop
+		case <-ticker.C:
+		}
+	}
+	close(jobChan)
+	wg.Wait()
+}
+
+// isArchive is true for the archives next to the files of Pattern, not for
+// a file of Pattern itself
+func (w *Watcher) isArchive(file string) bool {
+	if matched, _ := filepath.Match(w.Pattern, file); matched {
+		return false
+	}
+	return parser.IsArchive(file)
+}
+
+func (w *Watcher) release(file string) {
+	w.mutex.Lock()
+	delete(w.busy, file)
+	w.mutex.Unlock()
+}
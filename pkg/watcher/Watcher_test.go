@@ -0,0 +1,186 @@
+package watcher
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tempInbox(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "watcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestReadyStable(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempInbox(t)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "sample_1.txt")
+	ioutil.WriteFile(file, []byte("abc\n"), 0644)
+
+	w := NewWatcher(filepath.Join(dir, "*.txt"), "")
+	ready, err := w.Ready()
+	assert.Nil(err)
+	assert.Empty(ready)
+
+	ready, err = w.Ready()
+	assert.Nil(err)
+	assert.Equal([]string{file}, ready)
+
+	// handed out already
+	ready, _ = w.Ready()
+	assert.Empty(ready)
+}
+
+// writeArchive writes a zip of empty members
+func writeArchive(path string, members ...string) {
+	file, _ := os.Create(path)
+	defer file.Close()
+	archive := zip.NewWriter(file)
+	for _, member := range members {
+		archive.Create(member)
+	}
+	archive.Close()
+}
+
+func TestReadyCompressed(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempInbox(t)
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"sample_1.txt.gz", "notes.md"} {
+		ioutil.WriteFile(filepath.Join(dir, name), []byte("abc\n"), 0644)
+	}
+	writeArchive(filepath.Join(dir, "bundle.zip"), "sample_2.txt")
+	writeArchive(filepath.Join(dir, "other.zip"), "notes.md")
+
+	w := NewWatcher(filepath.Join(dir, "*.txt"), "")
+	w.Ready()
+	ready, err := w.Ready()
+	assert.Nil(err)
+	assert.Equal([]string{filepath.Join(dir, "sample_1.txt.gz"), filepath.Join(dir, "bundle.zip")}, ready)
+	// an archive without members of the pattern stays where it is
+	ready, _ = w.Ready()
+	assert.Empty(ready)
+	assert.FileExists(filepath.Join(dir, "other.zip"))
+}
+
+func TestDoneSharedArchive(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempInbox(t)
+	defer os.RemoveAll(dir)
+	archive := filepath.Join(dir, "bundle.zip")
+	writeArchive(archive, "sample_1.txt", "utf8_1.txt")
+
+	samplePattern, utf8Pattern := filepath.Join(dir, "sample_*.txt"), filepath.Join(dir, "utf8_*.txt")
+	archives := NewArchives(samplePattern, utf8Pattern, filepath.Join(dir, "other_*.txt"))
+	sample, utf8 := NewWatcher(samplePattern, ""), NewWatcher(utf8Pattern, "")
+	sample.Archives, utf8.Archives = archives, archives
+	for _, w := range []*Watcher{sample, utf8} {
+		w.Ready()
+		ready, _ := w.Ready()
+		assert.Equal([]string{archive}, ready)
+	}
+
+	// the first job leaves it to the other one
+	assert.Nil(sample.Done(archive, fmt.Errorf("bad member")))
+	assert.FileExists(archive)
+	ready, _ := sample.Ready()
+	assert.Empty(ready)
+
+	assert.Nil(utf8.Done(archive, nil))
+	assert.FileExists(filepath.Join(dir, DefaultFailedDir, "bundle.zip"))
+	_, err := os.Stat(archive)
+	assert.True(os.IsNotExist(err))
+	sample.Ready()
+	assert.Empty(sample.kept)
+}
+
+func TestReadyGrowing(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempInbox(t)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "sample_1.txt")
+	ioutil.WriteFile(file, []byte("abc\n"), 0644)
+
+	w := NewWatcher(filepath.Join(dir, "*.txt"), "")
+	w.Ready()
+	ioutil.WriteFile(file, []byte("abc\ndef\n"), 0644)
+	ready, _ := w.Ready()
+	assert.Empty(ready)
+	ready, _ = w.Ready()
+	assert.Equal([]string{file}, ready)
+}
+
+func TestReadyMarker(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempInbox(t)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "sample_1.txt")
+	ioutil.WriteFile(file, []byte("abc\n"), 0644)
+
+	w := NewWatcher(filepath.Join(dir, "*"), ".done")
+	ready, _ := w.Ready()
+	assert.Empty(ready)
+
+	ioutil.WriteFile(file+".done", nil, 0644)
+	ready, _ = w.Ready()
+	assert.Equal([]string{file}, ready)
+
+	assert.Nil(w.Done(file, nil))
+	assert.FileExists(filepath.Join(dir, DefaultProcessedDir, "sample_1.txt"))
+	assert.FileExists(filepath.Join(dir, DefaultProcessedDir, "sample_1.txt.done"))
+	ready, _ = w.Ready()
+	assert.Empty(ready)
+}
+
+func TestDoneFailed(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempInbox(t)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "sample_1.txt")
+	ioutil.WriteFile(file, []byte("abc\n"), 0644)
+
+	w := NewWatcher(filepath.Join(dir, "*.txt"), "")
+	assert.Nil(w.Done(file, fmt.Errorf("bad file")))
+	assert.FileExists(filepath.Join(dir, DefaultFailedDir, "sample_1.txt"))
+	_, err := os.Stat(file)
+	assert.True(os.IsNotExist(err))
+}
+
+func TestRun(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempInbox(t)
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"sample_1.txt", "sample_2.txt"} {
+		ioutil.WriteFile(filepath.Join(dir, name), []byte("abc\n"), 0644)
+	}
+
+	var mutex sync.Mutex
+	var loaded []string
+	cancelContext, cancel := context.WithCancel(context.Background())
+	w := NewWatcher(filepath.Join(dir, "*.txt"), "")
+	w.Run(cancelContext, time.Millisecond, 2, func(_ context.Context, file string) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		loaded = append(loaded, filepath.Base(file))
+		if len(loaded) == 2 {
+			cancel()
+		}
+		if filepath.Base(file) == "sample_2.txt" {
+			return fmt.Errorf("bad file")
+		}
+		return nil
+	})
+	assert.ElementsMatch([]string{"sample_1.txt", "sample_2.txt"}, loaded)
+}
@@ -0,0 +1,260 @@
+package worker
+
+import (
+	"data_play/pkg/config"
+	"data_play/pkg/parser"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+// ModelGroup is the group of a FilePattern naming the spec of the file
+const ModelGroup = "model"
+
+// defaultTextSize keeps a TEXT group a VARCHAR(255) whatever its length
+const defaultTextSize = 255
+
+// FilePattern matches the base name of a data file. The model group picks
+// the spec and every other named group is loaded as a column of each row,
+// like load_date in ^(?P<model>daily_sales)_(?P<load_date>\d{8})\.txt$
+type FilePattern struct {
+	Regexp *regexp.Regexp
+	// Columns types the other groups, a group not in it is TEXT
+	Columns map[string]*parser.SQLMeta
+}
+
+// Partition is what a file name adds to every row of the file
+type Partition struct {
+	Metas  []*parser.SQLMeta
+	Values map[string]interface{}
+}
+
+// names are the columns of the partition
+func (p *Partition) names() []string {
+	names := make([]string, len(p.Metas))
+	for i, meta := range p.Metas {
+		names[i] = meta.Name
+	}
+	return names
+}
+
+// row returns the values of the partition in the order of its metas
+func (p *Partition) row() []interface{} {
+	values := make([]interface{}, len(p.Metas))
+	for i, meta := range p.Metas {
+		values[i] = p.Values[meta.Name]
+	}
+	return values
+}
+
+func NewFilePattern(expr string, columns map[string]*parser.SQLMeta) (*FilePattern, error) {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("Fail to compile pattern %s, %v", expr, err)
+	}
+	groups := make(map[string]bool)
+	for _, name := range re.SubexpNames() {
+		if name != "" {
+			groups[name] = true
+		}
+	}
+	if !groups[ModelGroup] {
+		return nil, fmt.Errorf("Pattern %s has no %s group", expr, ModelGroup)
+	}
+	for name, meta := range columns {
+		if !groups[name] || name == ModelGroup {
+			return nil, fmt.Errorf("Pattern %s has no %s group", expr, name)
+		}
+		meta.Extra = true
+	}
+	return &FilePattern{Regexp: re, Columns: columns}, nil
+}
+
+// Match returns the model and the partition of dataFile, ok is false when
+// the pattern does not match. A compressed file is also matched without its
+// extension, so sample_1.txt.gz matches like sample_1.txt.
+func (fp *FilePattern) Match(dataFile string) (string, *Partition, bool, error) {
+	name := filepath.Base(dataFile)
+	groups := fp.Regexp.FindStringSubmatch(name)
+	if groups == nil {
+		groups = fp.Regexp.FindStringSubmatch(parser.TrimCompression(name))
+	}
+	if groups == nil {
+		return "", nil, false, nil
+	}
+	var model string
+	partition := &Partition{Values: make(map[string]interface{})}
+	for i, name := range fp.Regexp.SubexpNames() {
+		switch name {
+		case "":
+			continue
+		case ModelGroup:
+			model = groups[i]
+			continue
+		}
+		meta, ok := fp.Columns[name]
+		if !ok {
+			meta = &parser.SQLMeta{Name: name, Size: defaultTextSize, DataType: "TEXT", Extra: true}
+		}
+		value, err := parser.ParseValue(groups[i], meta)
+		if err != nil {
+			return "", nil, true, fmt.Errorf("Fail to parse %s of %s, %v", name, dataFile, err)
+		}
+		partition.Metas = append(partition.Metas, meta)
+		partition.Values[name] = value
+	}
+	if model == "" {
+		return "", nil, true, fmt.Errorf("Pattern %s matches %s without a model", fp.Regexp, dataFile)
+	}
+	return model, partition, true, nil
+}
+
+// MatchFile returns the model and the partition of dataFile from the first
+// pattern matching it, without patterns the model is ModelName
+func MatchFile(patterns []*FilePattern, dataFile string) (string, *Partition, error) {
+	if len(patterns) == 0 {
+		return ModelName(dataFile), &Partition{}, nil
+	}
+	for _, pattern := range patterns {
+		model, partition, ok, err := pattern.Match(dataFile)
+		if ok {
+			return model, partition, err
+		}
+	}
+	return "", nil, fmt.Errorf("File %s matches no pattern", dataFile)
+}
+
+// JobPatterns compiles the patterns of a configured job
+func JobPatterns(job *config.Job) ([]*FilePattern, error) {
+	var patterns []*FilePattern
+	for _, pattern := range job.Patterns {
+		columns := make(map[string]*parser.SQLMeta)
+		for name, column := range pattern.Columns {
+			meta := &parser.SQLMeta{
+				Name:     name,
+				Size:     column.Size,
+				DataType: strings.ToUpper(column.Type),
+				Format:   column.Format,
+				Scale:    column.Scale,
+			}
+			if meta.DataType == "" {
+				meta.DataType = "TEXT"
+			}
+			if meta.DataType == "TEXT" && meta.Size == 0 {
+				meta.Size = defaultTextSize
+			}
+			columns[name] = meta
+		}
+		filePattern, err := NewFilePattern(pattern.Regex, columns)
+		if err != nil {
+			return nil, err
+		}
+		err = filePattern.checkGroups(job.SpecDir, job.Lineage)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, filePattern)
+	}
+	return patterns, nil
+}
+
+// groups are the names of the groups loaded as columns
+func (fp *FilePattern) groups() []string {
+	var names []string
+	for _, name := range fp.Regexp.SubexpNames() {
+		if name != "" && name != ModelGroup {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// checkGroups refuses a group named like a lineage column, when lineage
+// is on, or like a column of a spec in specDir the model group can pick,
+// since the table would get the column twice
+func (fp *FilePattern) checkGroups(specDir string, lineage bool) error {
+	groups := fp.groups()
+	if lineage {
+		for _, name := range groups {
+			for _, meta := range lineageMetas {
+				if name == meta.Name {
+					return fmt.Errorf("Group %s of pattern %s is a lineage column", name, fp.Regexp)
+				}
+			}
+		}
+	}
+	models, err := fp.models(specDir)
+	if err != nil {
+		return err
+	}
+	factory := parser.NewDataParserFactory(filepath.Clean(specDir) + string(filepath.Separator))
+	for _, model := range models {
+		p, err := factory.MakeParser(model)
+		if err != nil {
+			// a bad spec fails the files of its model when they load
+			continue
+		}
+		if err = checkPartition(groups, p, model); err != nil {
+			return fmt.Errorf("Pattern %s, %v", fp.Regexp, err)
+		}
+	}
+	return nil
+}
+
+// models are the specs of specDir the model group matches in full
+func (fp *FilePattern) models(specDir string) ([]string, error) {
+	re, err := syntax.Parse(fp.Regexp.String(), syntax.Perl)
+	if err != nil {
+		return nil, fmt.Errorf("Fail to compile pattern %s, %v", fp.Regexp, err)
+	}
+	group := findCapture(re, ModelGroup)
+	if group == nil {
+		return nil, nil
+	}
+	model, err := regexp.Compile(`^(?:` + group.Sub[0].String() + `)$`)
+	if err != nil {
+		return nil, fmt.Errorf("Fail to compile pattern %s, %v", fp.Regexp, err)
+	}
+	specs, err := filepath.Glob(filepath.Join(specDir, "*.csv"))
+	if err != nil {
+		return nil, err
+	}
+	var models []string
+	for _, spec := range specs {
+		name := strings.TrimSuffix(filepath.Base(spec), ".csv")
+		if model.MatchString(name) {
+			models = append(models, name)
+		}
+	}
+	return models, nil
+}
+
+func findCapture(re *syntax.Regexp, name string) *syntax.Regexp {
+	if re.Op == syntax.OpCapture && re.Name == name {
+		return re
+	}
+	for _, sub := range re.Sub {
+		if found := findCapture(sub, name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// checkPartition refuses a column of the file name that is also a column
+// of the spec of model
+func checkPartition(names []string, p parser.DataParser, model string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	for _, meta := range specMetas(p) {
+		for _, name := range names {
+			if meta.Name == name {
+				return fmt.Errorf("group %s is a column of spec %s", name, model)
+			}
+		}
+	}
+	return nil
+}
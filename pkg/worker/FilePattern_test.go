@@ -0,0 +1,97 @@
+package worker
+
+import (
+	"data_play/pkg/config"
+	"data_play/pkg/parser"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilePatternMatch(t *testing.T) {
+	assert := assert.New(t)
+	pattern, err := NewFilePattern(`^(?P<model>daily_sales)_(?P<load_date>\d{8})_(?P<region>[a-z]+)\.txt$`, map[string]*parser.SQLMeta{
+		"load_date": &parser.SQLMeta{Name: "load_date", DataType: "DATE"},
+	})
+	assert.Nil(err)
+
+	model, partition, ok, err := pattern.Match("data/daily_sales_20200329_east.txt")
+	assert.True(ok)
+	assert.Nil(err)
+	assert.Equal("daily_sales", model)
+	assert.Equal(map[string]interface{}{
+		"load_date": time.Date(2020, 3, 29, 0, 0, 0, 0, time.UTC),
+		"region":    "east",
+	}, partition.Values)
+	assert.Equal("TEXT", partition.Metas[1].DataType)
+	// a migration keeps the columns of the file name
+	assert.True(partition.Metas[0].Extra)
+	assert.True(partition.Metas[1].Extra)
+
+	_, _, ok, _ = pattern.Match("data/sample_2020-03-29.txt")
+	assert.False(ok)
+
+	model, _, ok, _ = pattern.Match("data/bundle.zip!/daily_sales_20200329_east.txt.gz")
+	assert.True(ok)
+	assert.Equal("daily_sales", model)
+
+	_, _, ok, err = pattern.Match("data/daily_sales_20201399_east.txt")
+	assert.True(ok)
+	assert.Error(err)
+}
+
+func TestNewFilePatternInvalid(t *testing.T) {
+	_, err := NewFilePattern(`^(?P<name>[a-z]+)\.txt$`, nil)
+	assert.Error(t, err)
+	_, err = NewFilePattern(`^(?P<model>[a-z]+\.txt$`, nil)
+	assert.Error(t, err)
+	_, err = NewFilePattern(`^(?P<model>[a-z]+)\.txt$`, map[string]*parser.SQLMeta{"day": &parser.SQLMeta{}})
+	assert.Error(t, err)
+}
+
+func TestMatchFile(t *testing.T) {
+	assert := assert.New(t)
+	model, partition, err := MatchFile(nil, "data/sample_2020-03-29.txt")
+	assert.Nil(err)
+	assert.Equal("sample", model)
+	assert.Empty(partition.Values)
+
+	pattern, _ := NewFilePattern(`^(?P<model>daily_sales)_\d+\.txt$`, nil)
+	model, _, err = MatchFile([]*FilePattern{pattern}, "daily_sales_2020.txt")
+	assert.Nil(err)
+	assert.Equal("daily_sales", model)
+	_, _, err = MatchFile([]*FilePattern{pattern}, "sample_2020.txt")
+	assert.Error(err)
+}
+
+func TestJobPatternsCollision(t *testing.T) {
+	assert := assert.New(t)
+	dir, _ := ioutil.TempDir("", "TestJobPatternsCollision")
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "daily_sales.csv"), []byte("name,size,datatype\nregion,5,TEXT\namount,9,DECIMAL\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "weekly.csv"), []byte("name,size,datatype\namount,9,DECIMAL\n"), 0644)
+	job := &config.Job{
+		SpecDir: dir,
+		Patterns: []*config.Pattern{
+			&config.Pattern{Regex: `^(?P<model>[a-z_]+)_(?P<region>[a-z]+)\.txt$`},
+		},
+	}
+	// daily_sales already has a region column
+	_, err := JobPatterns(job)
+	assert.Error(err)
+
+	job.Patterns[0].Regex = `^(?P<model>weekly)_(?P<region>[a-z]+)\.txt$`
+	_, err = JobPatterns(job)
+	assert.Nil(err)
+
+	job.Patterns[0].Regex = `^(?P<model>weekly)_(?P<source_file>[a-z]+)\.txt$`
+	_, err = JobPatterns(job)
+	assert.Nil(err)
+	job.Lineage = true
+	_, err = JobPatterns(job)
+	assert.Error(err)
+}
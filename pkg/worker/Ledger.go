@@ -0,0 +1,31 @@
+package worker
+
+import (
+	"crypto/sha256"
+	"data_play/pkg/database"
+	"data_play/pkg/parser"
+	"encoding/hex"
+	"io"
+	"path/filepath"
+)
+
+// newLedgerEntry identifies a load by the file name and a sha256 of its
+// content, so a renamed directory or a fixed resend are told apart
+func newLedgerEntry(dataFile, specVersion string) (*database.LedgerEntry, error) {
+	file, err := parser.OpenData(dataFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return nil, err
+	}
+	return &database.LedgerEntry{
+		FileName:    filepath.Base(dataFile),
+		FileSize:    size,
+		Checksum:    hex.EncodeToString(hash.Sum(nil)),
+		SpecVersion: specVersion,
+	}, nil
+}
@@ -0,0 +1,54 @@
+package worker
+
+import (
+	"data_play/pkg/parser"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// lineage columns added to every row when SQLWorker.Lineage is set
+const (
+	LineageFile     = "source_file"
+	LineageLine     = "source_line"
+	LineageLoadedAt = "loaded_at"
+)
+
+var lineageMetas = []*parser.SQLMeta{
+	&parser.SQLMeta{Name: LineageFile, Size: 1024, DataType: "TEXT", Extra: true},
+	&parser.SQLMeta{Name: LineageLine, DataType: "BIGINT", Extra: true},
+	&parser.SQLMeta{Name: LineageLoadedAt, DataType: "TIMESTAMP", Extra: true},
+}
+
+// lineIndex is the position of the source line in the partition, -1 when
+// the partition has no lineage
+func lineIndex(partition *Partition) int {
+	for i, meta := range partition.Metas {
+		if meta.Name == LineageLine {
+			return i
+		}
+	}
+	return -1
+}
+
+// withLineage adds the lineage columns to the partition of a file
+func withLineage(partition *Partition, metas []*parser.SQLMeta, dataFile string, loadedAt time.Time) (*Partition, error) {
+	for _, meta := range append(append([]*parser.SQLMeta{}, metas...), partition.Metas...) {
+		for _, lineage := range lineageMetas {
+			if meta.Name == lineage.Name {
+				return nil, fmt.Errorf("Column %s is already a lineage column", meta.Name)
+			}
+		}
+	}
+	values := map[string]interface{}{
+		LineageFile:     filepath.Base(dataFile),
+		LineageLoadedAt: loadedAt,
+	}
+	for name, value := range partition.Values {
+		values[name] = value
+	}
+	return &Partition{
+		Metas:  append(append([]*parser.SQLMeta{}, partition.Metas...), lineageMetas...),
+		Values: values,
+	}, nil
+}
@@ -0,0 +1,79 @@
+package worker
+
+import (
+	"context"
+	"data_play/pkg/parser"
+	"sync"
+)
+
+// recordBatch is the records a reader hands over at once
+const recordBatch = 256
+
+// record is a line of a data file, a row or the error of a bad row. A
+// fatal error ends the file.
+type record struct {
+	row    *parser.Row
+	layout *parser.Layout
+	line   int
+	text   string
+	err    error
+	fatal  bool
+}
+
+// readRecords reads every scanner in a goroutine of its own and sends their
+// records in batches, the channel is closed once they are all read or
+// cancelContext is done
+func readRecords(cancelContext context.Context, scanners []*parser.DataScanner) <-chan []record {
+	records := make(chan []record, len(scanners))
+	var wg sync.WaitGroup
+	for _, scanner := range scanners {
+		wg.Add(1)
+		go func(scanner *parser.DataScanner) {
+			defer wg.Done()
+			readScanner(cancelContext, scanner, records)
+		}(scanner)
+	}
+	go func() {
+		wg.Wait()
+		close(records)
+	}()
+	return records
+}
+
+func readScanner(cancelContext context.Context, scanner *parser.DataScanner, records chan<- []record) {
+	send := func(batch []record) bool {
+		select {
+		case <-cancelContext.Done():
+			return false
+		case records <- batch:
+			return true
+		}
+	}
+	// line counts the lines read so far, a fatal error is on the next one
+	line := scanner.Line()
+	batch := make([]record, 0, recordBatch)
+	for {
+		row, haveData, err := scanner.ReadRow()
+		if !haveData {
+			if err != nil {
+				batch = append(batch, record{line: line + 1, err: err, fatal: true})
+			}
+			if len(batch) > 0 {
+				send(batch)
+			}
+			return
+		}
+		line++
+		r := record{row: row, layout: scanner.Layout(), line: line, err: err}
+		if err != nil {
+			r.text = scanner.Text()
+		}
+		batch = append(batch, r)
+		if len(batch) == recordBatch {
+			if !send(batch) {
+				return
+			}
+			batch = make([]record, 0, recordBatch)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package worker
+
+import (
+	"data_play/pkg/parser"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// RejectPolicy lets a job load past rows that fail to parse. Rejected lines
+// are written to <input>.rejects and the job only fails once the rejects go
+// over MaxCount rows or MaxPercent of the lines read. A zero limit is unset.
+// MaxPercent is checked at the end of the file, so it needs a staged load
+// mode to keep the rows of a failed file out of the table.
+type RejectPolicy struct {
+	MaxCount   int
+	MaxPercent float64
+}
+
+func (p *RejectPolicy) exceedCount(rejects int) bool {
+	return p.MaxCount > 0 && rejects > p.MaxCount
+}
+
+// mayFail is true when bad rows can fail a file, always without a policy
+func (p *RejectPolicy) mayFail() bool {
+	return p == nil || p.MaxCount > 0 || p.MaxPercent > 0
+}
+
+func (p *RejectPolicy) exceedPercent(rejects, lines int) bool {
+	return p.MaxPercent > 0 && lines > 0 && float64(rejects)*100/float64(lines) > p.MaxPercent
+}
+
+// rejectWriter writes "line<TAB>reason<TAB>raw line" records, the file is
+// only created on the first reject
+type rejectWriter struct {
+	path string
+	file *os.File
+}
+
+func newRejectWriter(dataFile string) *rejectWriter {
+	path := dataFile + ".rejects"
+	if archive, member, ok := parser.SplitMember(dataFile); ok {
+		// next to the archive, data/bundle.zip!sample_1.txt.rejects
+		path = archive + "!" + strings.Replace(member, "/", "_", -1) + ".rejects"
+	}
+	// drop the rejects of a previous run of the same file
+	os.Remove(path)
+	return &rejectWriter{path: path}
+}
+
+func (r *rejectWriter) Write(line int, raw string, reason error) error {
+	var err error
+	if r.file == nil {
+		r.file, err = os.Create(r.path)
+		if err != nil {
+			return fmt.Errorf("Fail to create rejects file %s, %v", r.path, err)
+		}
+	}
+	_, err = fmt.Fprintf(r.file, "%d\t%v\t%s\n", line, reason, raw)
+	return err
+}
+
+func (r *rejectWriter) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	return r.file.Close()
+}
@@ -2,24 +2,130 @@ package worker
 
 import (
 	"context"
+	"data_play/pkg/config"
 	"data_play/pkg/database"
 	"data_play/pkg/parser"
 	"fmt"
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 )
 
+// load modes, append commits every buffer straight into the table while
+// merge and swap stage the whole file first and then append it or replace
+// the table content with it in one transaction
+const (
+	LoadAppend = "append"
+	LoadMerge  = "merge"
+	LoadSwap   = "swap"
+)
+
 type SQLWorker struct {
 	ParserFactory parser.DataParserFactory
 	DB            *sqlx.DB
 	Queryer       database.Queryer
 	BufferSize    int
+	// Rejects keeps loading past bad rows, nil stops at the first one
+	Rejects *RejectPolicy
+	// LoadMode is one of LoadAppend (default), LoadMerge or LoadSwap
+	LoadMode string
+	// Ledger skips files already loaded, unless Force reloads them
+	Ledger database.Ledger
+	Force  bool
+	// AllowDestructive lets a spec change narrow, retype or drop columns
+	AllowDestructive bool
+	// Tables maps a model to its table, a model not in it loads into the
+	// table of the same name
+	Tables map[string]string
+	// Patterns pick the model of a file and the columns its name adds to
+	// every row, without patterns the model is ModelName
+	Patterns []*FilePattern
+	// Lineage adds the source file, source line and load time to every row
+	Lineage bool
+	// Encoding of the data files, it overrides the encoding of the specs
+	Encoding string
+	// MaxRecordLength overrides the max record length of the specs
+	MaxRecordLength int
+	// ParseWorkers reads a file in this many record aligned ranges at the
+	// same time when it can be cut, see parser.DataScanner.Split. In append
+	// mode the rows of the ranges commit mixed, so bad rows must not fail
+	// the file, see splitRanges.
+	ParseWorkers int
+	// minChunkSize is the smallest range, parser.MinChunkSize when zero
+	minChunkSize int64
+	// Writers insert the batches of the files at the same time as they are
+	// read, by default as many as the max open connections of DB. They are
+	// shared by the files loaded at the same time.
+	Writers   int
+	slotsOnce sync.Once
+	slots     chan struct{}
 }
 
-func (f *SQLWorker) safeInsertData(cancelContext context.Context, modelName string, data []*map[string]interface{}) error {
+// NewSQLWorker builds the worker of a configured job. The ledger, when the
+// job uses one, still needs Init on the database before the first load.
+func NewSQLWorker(job *config.Job, db *sqlx.DB) (*SQLWorker, error) {
+	queryer, err := database.NewQueryer(job.Insert)
+	if err != nil {
+		return nil, err
+	}
+	switch job.LoadMode {
+	case "", LoadAppend, LoadMerge, LoadSwap:
+	default:
+		return nil, fmt.Errorf("Unknown load mode %s", job.LoadMode)
+	}
+	if job.BatchSize < 1 {
+		return nil, fmt.Errorf("Batch size must be positive")
+	}
+	patterns, err := JobPatterns(job)
+	if err != nil {
+		return nil, err
+	}
+	if err = parser.CheckEncoding(job.Encoding); err != nil {
+		return nil, err
+	}
+	if job.MaxRecordLength < 0 {
+		return nil, fmt.Errorf("Max record length must not be negative")
+	}
+	if job.ParseWorkers < 0 {
+		return nil, fmt.Errorf("Parse workers must not be negative")
+	}
+	sqlWorker := &SQLWorker{
+		DB:               db,
+		ParserFactory:    parser.NewDataParserFactory(filepath.Clean(job.SpecDir) + string(filepath.Separator)),
+		Queryer:          queryer,
+		BufferSize:       job.BatchSize,
+		LoadMode:         job.LoadMode,
+		Force:            job.Force,
+		AllowDestructive: job.AllowDestructive,
+		Tables:           job.Tables,
+		Patterns:         patterns,
+		Lineage:          job.Lineage,
+		Encoding:         job.Encoding,
+		MaxRecordLength:  job.MaxRecordLength,
+		ParseWorkers:     job.ParseWorkers,
+	}
+	if job.Rejects != nil {
+		sqlWorker.Rejects = &RejectPolicy{
+			MaxCount:   job.Rejects.MaxCount,
+			MaxPercent: job.Rejects.MaxPercent,
+		}
+	}
+	if sqlWorker.Rejects != nil && sqlWorker.Rejects.MaxPercent > 0 && !sqlWorker.staged() {
+		return nil, fmt.Errorf("Max reject percent needs the merge or swap load mode")
+	}
+	if job.ParseWorkers > 1 && !sqlWorker.splitRanges() {
+		return nil, fmt.Errorf("Parse workers in append mode need rejects without a limit, or the merge or swap load mode")
+	}
+	if job.UseLedger() {
+		sqlWorker.Ledger = database.NewLedger()
+	}
+	return sqlWorker, nil
+}
+
+func (f *SQLWorker) safeInsertData(cancelContext context.Context, modelName string, data []*parser.Row) error {
 	var tx *sqlx.Tx
 	var err error
 
@@ -40,74 +146,317 @@ func (f *SQLWorker) safeInsertData(cancelContext context.Context, modelName stri
 	return nil
 }
 
+// safePromoteStaging moves the staging tables of every target into their
+// tables in one transaction
+func (f *SQLWorker) safePromoteStaging(cancelContext context.Context, targets []*target) error {
+	var tx *sqlx.Tx
+	var err error
+
+	tx, err = f.DB.BeginTxx(cancelContext, nil)
+	if err != nil {
+		return fmt.Errorf("Fail to create Transaction, %v", err)
+	}
+	for _, t := range targets {
+		err = f.Queryer.PromoteStagingTable(tx, t.insert, t.table, f.LoadMode == LoadSwap)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("Fail to promote %s, %v", t.insert, err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("Fail to commit staging tables, %v", err)
+	}
+	return nil
+}
+
+func (f *SQLWorker) chunkSize() int64 {
+	if f.minChunkSize > 0 {
+		return f.minChunkSize
+	}
+	return parser.MinChunkSize
+}
+
+func (f *SQLWorker) staged() bool {
+	return f.LoadMode == LoadMerge || f.LoadMode == LoadSwap
+}
+
+// splitRanges is true when a file may be read in ranges. A bad row stops
+// the file in the middle of batches from every range, which a staged load
+// throws away but append mode would leave in the table.
+func (f *SQLWorker) splitRanges() bool {
+	return f.staged() || !f.Rejects.mayFail()
+}
+
+// ModelName is the spec of a data file, the base name up to the first _
+func ModelName(dataFile string) string {
+	return strings.Split(filepath.Base(dataFile), "_")[0]
+}
+
 func (f *SQLWorker) runInputJob(cancelContext context.Context, dataFile string) error {
 	var err error
 	var p parser.DataParser
 
-	// assume only one _
-	modelName := strings.Split(filepath.Base(dataFile), "_")[0]
+	modelName, partition, err := MatchFile(f.Patterns, dataFile)
+	if err != nil {
+		return err
+	}
 
 	p, err = f.ParserFactory.MakeParser(modelName)
 	if err != nil {
 		return err
 	}
+	if err = checkPartition(partition.names(), p, modelName); err != nil {
+		return fmt.Errorf("File %s, %v", dataFile, err)
+	}
+	if f.Lineage {
+		partition, err = withLineage(partition, specMetas(p), dataFile, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+	}
 
-	select {
-	case <-cancelContext.Done():
-		return fmt.Errorf("Canceled before create Table %s", modelName)
-	default:
-		err = f.Queryer.CreateTable(f.DB, modelName, p.Meta())
+	var ledgerID int64
+	if f.Ledger != nil {
+		var entry *database.LedgerEntry
+		entry, err = newLedgerEntry(dataFile, p.Version())
+		if err != nil {
+			return err
+		}
+		if !f.Force {
+			var loaded bool
+			loaded, err = f.Ledger.IsLoaded(f.DB, entry)
+			if err != nil {
+				return fmt.Errorf("Fail to read ledger, %v", err)
+			}
+			if loaded {
+				fmt.Printf("[Skip] File %s already loaded\n", dataFile)
+				return nil
+			}
+		}
+		ledgerID, err = f.Ledger.Begin(f.DB, entry)
+		if err != nil {
+			return fmt.Errorf("Fail to write ledger, %v", err)
+		}
+	}
+
+	var inserted int
+	inserted, err = f.loadModel(cancelContext, p, partition, dataFile, modelName)
+	if f.Ledger != nil {
+		status := database.LedgerSuccess
+		if err != nil {
+			status = database.LedgerFailed
+		}
+		ledgerErr := f.Ledger.Finish(f.DB, ledgerID, status, inserted)
+		if err == nil && ledgerErr != nil {
+			err = fmt.Errorf("File %s, inserted: %d fail to write ledger, %v", dataFile, inserted, ledgerErr)
+		}
 	}
 	if err != nil {
 		return err
 	}
+	fmt.Printf("[Done] File %s inserted: %d\n", dataFile, inserted)
+	return nil
+}
+
+func (f *SQLWorker) tableName(modelName string) string {
+	if tableName, ok := f.Tables[modelName]; ok {
+		return tableName
+	}
+	return modelName
+}
+
+// loadModel creates the tables of the model and loads dataFile into them,
+// through staging tables when the load mode asks for them
+func (f *SQLWorker) loadModel(cancelContext context.Context, p parser.DataParser, partition *Partition, dataFile, modelName string) (int, error) {
+	targets, err := f.targets(p, partition, modelName)
+	if err != nil {
+		return 0, err
+	}
+	for _, t := range targets.list {
+		select {
+		case <-cancelContext.Done():
+			return 0, fmt.Errorf("Canceled before create Table %s", t.table)
+		default:
+			err = f.Queryer.CreateTable(f.DB, t.table, t.metas)
+		}
+		if err != nil {
+			return 0, err
+		}
+		err = f.Queryer.MigrateTable(f.DB, t.table, t.metas, f.AllowDestructive)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	for i, t := range targets.list {
+		t.insert = t.table
+		if !f.staged() {
+			continue
+		}
+		t.insert = database.StagingName(t.table, time.Now())
+		err = f.Queryer.CreateStagingTable(f.DB, t.table, t.insert)
+		if err != nil {
+			f.dropStaging(targets.list[:i])
+			return 0, err
+		}
+	}
+
+	var inserted int
+	inserted, err = f.loadFile(cancelContext, p, partition, dataFile, targets)
+	if err == nil && f.staged() {
+		err = f.safePromoteStaging(cancelContext, targets.list)
+		if err != nil {
+			err = fmt.Errorf("File %s, staged: %d failed: %v", dataFile, inserted, err)
+		}
+	}
+	if err != nil && f.staged() {
+		f.dropStaging(targets.list)
+		// nothing reached the tables
+		inserted = 0
+	}
+	return inserted, err
+}
+
+func (f *SQLWorker) dropStaging(targets []*target) {
+	for _, t := range targets {
+		f.Queryer.DropTable(f.DB, t.insert)
+	}
+}
+
+// loadFile inserts every row of dataFile into the table of its record type
+// and returns the number of rows inserted
+func (f *SQLWorker) loadFile(cancelContext context.Context, p parser.DataParser, partition *Partition, dataFile string, targets *targetSet) (int, error) {
+	var err error
 	var scanner *parser.DataScanner
 	scanner, err = p.Parse(dataFile)
-	defer scanner.Close()
 	if err != nil {
-		return err
+		return 0, err
+	}
+	defer scanner.Close()
+	if f.Encoding != "" {
+		err = scanner.SetEncoding(f.Encoding)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if f.MaxRecordLength > 0 {
+		err = scanner.SetMaxRecordLength(f.MaxRecordLength)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	scanners := []*parser.DataScanner{scanner}
+	if f.ParseWorkers > 1 && f.splitRanges() {
+		scanners, err = scanner.Split(f.ParseWorkers, f.chunkSize())
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var rejects *rejectWriter
+	if f.Rejects != nil {
+		rejects = newRejectWriter(dataFile)
+		defer rejects.Close()
 	}
 
-	var buffer []*map[string]interface{}
-	var datum *map[string]interface{}
-	var haveData = true
+	// the readers stop with the writers, a failed insert ends the file
+	writers := f.startWriters(cancelContext, f.writers())
+	readContext, stopReading := context.WithCancel(writers.ctx)
+	records := readRecords(readContext, scanners)
+	defer func() {
+		// the readers are done with the file before it is closed
+		stopReading()
+		for range records {
+		}
+	}()
+
 	var line = 1
+	var read = 0
+	var rejected = 0
+	partitionValues := partition.row()
+	lineColumn := lineIndex(partition)
 loop:
 	for {
+		var batch []record
+		var ok bool
 		select {
-		case <-cancelContext.Done():
-			err = fmt.Errorf("Canceled")
+		case <-readContext.Done():
 			break loop
-		default:
-			datum, haveData, err = scanner.ReadRow()
-			if !haveData || err != nil {
+		case batch, ok = <-records:
+		}
+		if !ok {
+			break loop
+		}
+		for _, r := range batch {
+			line = r.line
+			if r.fatal {
+				err = r.err
 				break loop
 			}
-
-			buffer = append(buffer, datum)
-			if len(buffer) >= f.BufferSize {
-				err = f.safeInsertData(cancelContext, modelName, buffer)
+			read++
+			if r.err != nil {
+				if rejects == nil {
+					err = r.err
+					break loop
+				}
+				err = rejects.Write(r.line, r.text, r.err)
 				if err != nil {
-					err = fmt.Errorf("Inserted Error: line: %d err: %v", line-f.BufferSize, err)
 					break loop
 				}
-				buffer = []*map[string]interface{}{}
+				rejected++
+				if f.Rejects.exceedCount(rejected) {
+					err = fmt.Errorf("Too many rejects: %d, see %s", rejected, rejects.path)
+					break loop
+				}
+				continue
 			}
-			line++
 
+			if lineColumn >= 0 {
+				partitionValues[lineColumn] = int64(r.line)
+			}
+			t := targets.route(r.layout)
+			if len(t.buffer) == 0 {
+				t.firstLine = r.line
+			}
+			t.buffer = append(t.buffer, t.row(r.row, partitionValues))
+			if len(t.buffer) >= f.BufferSize && !writers.write(t) {
+				break loop
+			}
 		}
 	}
-	if err != nil {
-		return fmt.Errorf("File %s, inserted: %d line %d failed: %v", dataFile, line-1-len(buffer), line-1, err)
+	for _, t := range targets.list {
+		if err != nil || len(t.buffer) == 0 {
+			continue
+		}
+		if !writers.write(t) {
+			break
+		}
 	}
-	if len(buffer) > 0 {
-		err = f.safeInsertData(cancelContext, modelName, buffer)
+	inserted, writeErr := writers.wait()
+	if err == nil && cancelContext.Err() != nil {
+		err = fmt.Errorf("Canceled")
 	}
 	if err != nil {
-		return fmt.Errorf("File %s, inserted: %d failed: %v", dataFile, line-1-len(buffer), err)
+		return inserted, fmt.Errorf("File %s, inserted: %d line %d failed: %v", dataFile, inserted, line, err)
 	}
-	fmt.Printf("[Done] File %s inserted: %d\n", dataFile, line-1)
-	return nil
+	if writeErr != nil {
+		return inserted, fmt.Errorf("File %s, inserted: %d failed: %v", dataFile, inserted, writeErr)
+	}
+	if rejected > 0 {
+		if f.Rejects.exceedPercent(rejected, read) {
+			return inserted, fmt.Errorf("File %s, inserted: %d rejected: %d over %.2f%%, see %s", dataFile, inserted, rejected, f.Rejects.MaxPercent, rejects.path)
+		}
+		fmt.Printf("[Rejected] File %s rejected: %d, see %s\n", dataFile, rejected, rejects.path)
+	}
+	return inserted, nil
+}
+
+// Run loads a single data file
+func (f *SQLWorker) Run(cancelContext context.Context, dataFile string) error {
+	return f.runInputJob(cancelContext, dataFile)
 }
 
 func (f *SQLWorker) Start(jobChan <-chan string, wg *sync.WaitGroup, cancelContext context.Context) {
@@ -3,9 +3,15 @@ package worker
 import (
 	"bufio"
 	"context"
+	"data_play/pkg/config"
+	"data_play/pkg/database"
 	"data_play/pkg/parser"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -25,11 +31,31 @@ func (q *MockQueryer) CreateTable(conn sqlx.Execer, tableName string, metas []*p
 	return args.Error(0)
 }
 
-func (q *MockQueryer) InsertData(conn sqlx.Ext, tableName string, rows []*map[string]interface{}) error {
+func (q *MockQueryer) InsertData(conn sqlx.Ext, tableName string, rows []*parser.Row) error {
 	args := q.Called(conn, tableName, rows)
 	return args.Error(0)
 }
 
+func (q *MockQueryer) CreateStagingTable(conn sqlx.Execer, tableName, stagingName string) error {
+	args := q.Called(conn, tableName, stagingName)
+	return args.Error(0)
+}
+
+func (q *MockQueryer) PromoteStagingTable(conn sqlx.Execer, stagingName, tableName string, replace bool) error {
+	args := q.Called(conn, stagingName, tableName, replace)
+	return args.Error(0)
+}
+
+func (q *MockQueryer) MigrateTable(conn sqlx.Ext, tableName string, metas []*parser.SQLMeta, allowDestructive bool) error {
+	args := q.Called(conn, tableName, metas, allowDestructive)
+	return args.Error(0)
+}
+
+func (q *MockQueryer) DropTable(conn sqlx.Execer, tableName string) error {
+	args := q.Called(conn, tableName)
+	return args.Error(0)
+}
+
 type MockParserFactory struct {
 	mock.Mock
 }
@@ -41,6 +67,7 @@ func (pf *MockParserFactory) MakeParser(modelName string) (parser.DataParser, er
 
 type MockDataParser struct {
 	mock.Mock
+	layouts []*parser.Layout
 }
 
 func (dp *MockDataParser) Parse(filePath string) (*parser.DataScanner, error) {
@@ -53,6 +80,39 @@ func (dp *MockDataParser) Meta() []*parser.SQLMeta {
 	return args.Get(0).([]*parser.SQLMeta)
 }
 
+func (dp *MockDataParser) Layouts() []*parser.Layout {
+	return dp.layouts
+}
+
+func (dp *MockDataParser) Version() string {
+	args := dp.Called()
+	return args.String(0)
+}
+
+type MockLedger struct {
+	mock.Mock
+}
+
+func (l *MockLedger) Init(conn sqlx.Execer) error {
+	args := l.Called(conn)
+	return args.Error(0)
+}
+
+func (l *MockLedger) IsLoaded(conn sqlx.Queryer, entry *database.LedgerEntry) (bool, error) {
+	args := l.Called(conn, entry)
+	return args.Bool(0), args.Error(1)
+}
+
+func (l *MockLedger) Begin(conn sqlx.Queryer, entry *database.LedgerEntry) (int64, error) {
+	args := l.Called(conn, entry)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (l *MockLedger) Finish(conn sqlx.Execer, id int64, status string, rowCount int) error {
+	args := l.Called(conn, id, status, rowCount)
+	return args.Error(0)
+}
+
 type SQLWorkerTestSuite struct {
 	suite.Suite
 	parserFactory *MockParserFactory
@@ -63,12 +123,6 @@ type SQLWorkerTestSuite struct {
 }
 
 func (s *SQLWorkerTestSuite) SetupSuite() {
-	mockDB, mock, err := sqlmock.New()
-	if err != nil {
-		fmt.Println(err)
-	}
-	s.db = sqlx.NewDb(mockDB, "sqlmock")
-	s.mockDB = mock
 	s.meta = []*parser.SQLMeta{
 		&parser.SQLMeta{
 			Name:     "name",
@@ -88,22 +142,32 @@ func (s *SQLWorkerTestSuite) SetupSuite() {
 	}
 }
 
+// SetupTest gives every test a database of its own, so the transactions of
+// a test never meet the expectations of another
 func (s *SQLWorkerTestSuite) SetupTest() {
+	db, mockDB, err := sqlmock.New()
+	if err != nil {
+		fmt.Println(err)
+	}
+	s.db = sqlx.NewDb(db, "sqlmock")
+	s.mockDB = mockDB
 	s.queryer = new(MockQueryer)
+	s.queryer.On("MigrateTable", mock.Anything, mock.Anything, mock.Anything, false).Return(nil)
 	s.parserFactory = new(MockParserFactory)
 }
 
-func (s *SQLWorkerTestSuite) TearDownSuite() {
+func (s *SQLWorkerTestSuite) TearDownTest() {
 	s.db.Close()
 }
 
 func (s *SQLWorkerTestSuite) TestSafeInsertDataSuccess() {
-	data := []*map[string]interface{}{}
+	data := []*parser.Row{}
 	worker := &SQLWorker{
 		DB:            s.db,
 		Queryer:       s.queryer,
 		ParserFactory: s.parserFactory,
 		BufferSize:    500,
+		Writers:       1,
 	}
 	s.mockDB.ExpectBegin()
 	s.queryer.On("InsertData", mock.Anything, "TestSafeInsertDataSuccess", data).Return(nil)
@@ -114,12 +178,13 @@ func (s *SQLWorkerTestSuite) TestSafeInsertDataSuccess() {
 }
 
 func (s *SQLWorkerTestSuite) TestSafeInsertDataInsertFail() {
-	data := []*map[string]interface{}{}
+	data := []*parser.Row{}
 	worker := &SQLWorker{
 		DB:            s.db,
 		Queryer:       s.queryer,
 		ParserFactory: s.parserFactory,
 		BufferSize:    500,
+		Writers:       1,
 	}
 	s.queryer.On("InsertData", mock.Anything, "TestSafeInsertDataInsertFail", data).Return(fmt.Errorf("wrong"))
 
@@ -135,6 +200,7 @@ func (s *SQLWorkerTestSuite) TestRunInputJobSuccess() {
 		Queryer:       s.queryer,
 		ParserFactory: s.parserFactory,
 		BufferSize:    500,
+		Writers:       1,
 	}
 	dp := new(MockDataParser)
 	s.parserFactory.On("MakeParser", "TestRunInputJobSuccess").Return(dp, nil)
@@ -148,12 +214,8 @@ func (s *SQLWorkerTestSuite) TestRunInputJobSuccess() {
 		"InsertData",
 		mock.Anything,
 		"TestRunInputJobSuccess",
-		[]*map[string]interface{}{
-			&map[string]interface{}{
-				"name":   "Hello",
-				"active": true,
-				"count":  123,
-			},
+		[]*parser.Row{
+			&parser.Row{Metas: s.meta, Values: []interface{}{"Hello", true, 123}},
 		},
 	).Return(nil)
 	s.mockDB.ExpectBegin()
@@ -169,6 +231,7 @@ func (s *SQLWorkerTestSuite) TestRunInputJobFailParse() {
 		Queryer:       s.queryer,
 		ParserFactory: s.parserFactory,
 		BufferSize:    1,
+		Writers:       1,
 	}
 	dp := new(MockDataParser)
 	s.parserFactory.On("MakeParser", "TestRunInputJobSuccess").Return(dp, nil)
@@ -183,12 +246,8 @@ abc1123`)),
 		"InsertData",
 		mock.Anything,
 		"TestRunInputJobSuccess",
-		[]*map[string]interface{}{
-			&map[string]interface{}{
-				"name":   "Hello",
-				"active": true,
-				"count":  123,
-			},
+		[]*parser.Row{
+			&parser.Row{Metas: s.meta, Values: []interface{}{"Hello", true, 123}},
 		},
 	).Return(nil)
 	s.mockDB.ExpectBegin()
@@ -198,6 +257,34 @@ abc1123`)),
 	assert.Error(s.T(), err)
 }
 
+func (s *SQLWorkerTestSuite) TestRunInputJobLineTooLong() {
+	worker := &SQLWorker{
+		DB:              s.db,
+		Queryer:         s.queryer,
+		ParserFactory:   s.parserFactory,
+		BufferSize:      10,
+		Writers:         1,
+		Rejects:         &RejectPolicy{},
+		MaxRecordLength: 16,
+	}
+	dp := new(MockDataParser)
+	s.parserFactory.On("MakeParser", "TestRunInputJobLineTooLong").Return(dp, nil)
+	dp.On("Meta").Return(s.meta)
+	dp.On("Parse", "TestRunInputJobLineTooLong_2020-03-29.txt").Return(&parser.DataScanner{
+		Metas: s.meta,
+		Scanner: bufio.NewScanner(strings.NewReader(`Hello     1  123
+World     1  123 with a line longer than the max`)),
+	}, nil)
+	s.queryer.On("CreateTable", mock.Anything, "TestRunInputJobLineTooLong", mock.Anything).Return(nil)
+
+	// a line too long fails the file even with rejects, the rows before it
+	// are never inserted
+	err := worker.runInputJob(context.Background(), "TestRunInputJobLineTooLong_2020-03-29.txt")
+	assert.Error(s.T(), err)
+	assert.Contains(s.T(), err.Error(), "Fail to read line 2, longer than the max record length of 16 bytes")
+	s.queryer.AssertNotCalled(s.T(), "InsertData", mock.Anything, "TestRunInputJobLineTooLong", mock.Anything)
+}
+
 func (s *SQLWorkerTestSuite) TestRunInputJobCancelledAtBegin() {
 	cancelContext, cancel := context.WithCancel(context.Background())
 	worker := &SQLWorker{
@@ -205,6 +292,7 @@ func (s *SQLWorkerTestSuite) TestRunInputJobCancelledAtBegin() {
 		Queryer:       s.queryer,
 		ParserFactory: s.parserFactory,
 		BufferSize:    1,
+		Writers:       1,
 	}
 	dp := new(MockDataParser)
 	s.parserFactory.On("MakeParser", "TestRunInputJobSuccess").Return(dp, nil)
@@ -223,6 +311,7 @@ func (s *SQLWorkerTestSuite) TestRunInputJobCancelledAtMiddle() {
 		Queryer:       s.queryer,
 		ParserFactory: s.parserFactory,
 		BufferSize:    1,
+		Writers:       1,
 	}
 	dp := new(MockDataParser)
 	s.parserFactory.On("MakeParser", "TestRunInputJobCancelledAtMiddle").Return(dp, nil)
@@ -237,24 +326,16 @@ World     1  123`)),
 		"InsertData",
 		mock.Anything,
 		"TestRunInputJobCancelledAtMiddle",
-		[]*map[string]interface{}{
-			&map[string]interface{}{
-				"name":   "Hello",
-				"active": true,
-				"count":  123,
-			},
+		[]*parser.Row{
+			&parser.Row{Metas: s.meta, Values: []interface{}{"Hello", true, 123}},
 		},
 	).Return(nil)
 	s.queryer.On(
 		"InsertData",
 		mock.Anything,
 		"TestRunInputJobCancelledAtMiddle",
-		[]*map[string]interface{}{
-			&map[string]interface{}{
-				"name":   "World",
-				"active": true,
-				"count":  123,
-			},
+		[]*parser.Row{
+			&parser.Row{Metas: s.meta, Values: []interface{}{"World", true, 123}},
 		},
 	).WaitUntil(time.After(1 * time.Second)).Return(nil)
 
@@ -266,6 +347,713 @@ World     1  123`)),
 	assert.Error(s.T(), err)
 }
 
+func (s *SQLWorkerTestSuite) runRejectsJob(dir string, policy *RejectPolicy, data string, commit bool) (string, error) {
+	dataFile := filepath.Join(dir, "TestRunInputJobRejects_2020-03-29.txt")
+	worker := &SQLWorker{
+		DB:            s.db,
+		Queryer:       s.queryer,
+		ParserFactory: s.parserFactory,
+		BufferSize:    500,
+		Writers:       1,
+		Rejects:       policy,
+	}
+	dp := new(MockDataParser)
+	s.parserFactory.On("MakeParser", "TestRunInputJobRejects").Return(dp, nil)
+	dp.On("Meta").Return(s.meta)
+	dp.On("Parse", dataFile).Return(&parser.DataScanner{
+		Metas:   s.meta,
+		Scanner: bufio.NewScanner(strings.NewReader(data)),
+	}, nil)
+	s.queryer.On("CreateTable", mock.Anything, "TestRunInputJobRejects", mock.Anything).Return(nil)
+	s.queryer.On("InsertData", mock.Anything, "TestRunInputJobRejects", mock.Anything).Return(nil)
+	if commit {
+		s.mockDB.ExpectBegin()
+		s.mockDB.ExpectCommit()
+	}
+
+	err := worker.runInputJob(context.Background(), dataFile)
+	return dataFile + ".rejects", err
+}
+
+func (s *SQLWorkerTestSuite) TestRunInputJobRejects() {
+	dir, _ := ioutil.TempDir("", "TestRunInputJobRejects")
+	defer os.RemoveAll(dir)
+	rejectsFile, err := s.runRejectsJob(dir, &RejectPolicy{MaxCount: 5}, `Hello     1  123
+abc1123
+World     0  321`, true)
+	assert.Nil(s.T(), err)
+	s.queryer.AssertCalled(s.T(), "InsertData", mock.Anything, "TestRunInputJobRejects", []*parser.Row{
+		&parser.Row{Metas: s.meta, Values: []interface{}{"Hello", true, 123}},
+		&parser.Row{Metas: s.meta, Values: []interface{}{"World", false, 321}},
+	})
+	content, err := ioutil.ReadFile(rejectsFile)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), "2\tnot enough length of data\tabc1123\n", string(content))
+}
+
+func (s *SQLWorkerTestSuite) TestRunInputJobRejectsOverCount() {
+	dir, _ := ioutil.TempDir("", "TestRunInputJobRejectsOverCount")
+	defer os.RemoveAll(dir)
+	_, err := s.runRejectsJob(dir, &RejectPolicy{MaxCount: 1}, `Hello     1  123
+abc1123
+def1123`, false)
+	assert.Error(s.T(), err)
+}
+
+func (s *SQLWorkerTestSuite) TestRunInputJobRejectsOverPercent() {
+	dir, _ := ioutil.TempDir("", "TestRunInputJobRejectsOverPercent")
+	defer os.RemoveAll(dir)
+	_, err := s.runRejectsJob(dir, &RejectPolicy{MaxPercent: 10}, `Hello     1  123
+abc1123
+World     0  321`, true)
+	assert.Error(s.T(), err)
+}
+
+func (s *SQLWorkerTestSuite) TestRunInputJobPercentStaged() {
+	dir, _ := ioutil.TempDir("", "TestRunInputJobPercentStaged")
+	defer os.RemoveAll(dir)
+	dataFile := filepath.Join(dir, "TestRunInputJobPercentStaged_2020-03-29.txt")
+	worker := &SQLWorker{
+		DB:            s.db,
+		Queryer:       s.queryer,
+		ParserFactory: s.parserFactory,
+		BufferSize:    1,
+		Writers:       1,
+		LoadMode:      LoadMerge,
+		Rejects:       &RejectPolicy{MaxPercent: 10},
+	}
+	isStaging := mock.MatchedBy(func(name string) bool {
+		return strings.HasPrefix(name, "TestRunInputJobPercentStaged_staging_")
+	})
+	dp := new(MockDataParser)
+	s.parserFactory.On("MakeParser", "TestRunInputJobPercentStaged").Return(dp, nil)
+	dp.On("Meta").Return(s.meta)
+	dp.On("Parse", dataFile).Return(&parser.DataScanner{
+		Metas: s.meta,
+		Scanner: bufio.NewScanner(strings.NewReader(`Hello     1  123
+abc1123
+World     0  321`)),
+	}, nil)
+	s.queryer.On("CreateTable", mock.Anything, "TestRunInputJobPercentStaged", mock.Anything).Return(nil)
+	s.queryer.On("CreateStagingTable", mock.Anything, "TestRunInputJobPercentStaged", isStaging).Return(nil)
+	s.queryer.On("InsertData", mock.Anything, isStaging, mock.Anything).Return(nil)
+	s.queryer.On("DropTable", mock.Anything, isStaging).Return(nil)
+	s.mockDB.ExpectBegin()
+	s.mockDB.ExpectCommit()
+	s.mockDB.ExpectBegin()
+	s.mockDB.ExpectCommit()
+
+	// the good rows were only staged, they never reach the table
+	err := worker.runInputJob(context.Background(), dataFile)
+	assert.Error(s.T(), err)
+	s.queryer.AssertNotCalled(s.T(), "PromoteStagingTable", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	s.queryer.AssertCalled(s.T(), "DropTable", mock.Anything, isStaging)
+	assert.Nil(s.T(), s.mockDB.ExpectationsWereMet())
+}
+
+func (s *SQLWorkerTestSuite) TestRunInputJobStagingSwap() {
+	worker := &SQLWorker{
+		DB:            s.db,
+		Queryer:       s.queryer,
+		ParserFactory: s.parserFactory,
+		BufferSize:    1,
+		Writers:       1,
+		LoadMode:      LoadSwap,
+	}
+	isStaging := mock.MatchedBy(func(name string) bool {
+		return strings.HasPrefix(name, "TestRunInputJobStagingSwap_staging_")
+	})
+	dp := new(MockDataParser)
+	s.parserFactory.On("MakeParser", "TestRunInputJobStagingSwap").Return(dp, nil)
+	dp.On("Meta").Return(s.meta)
+	dp.On("Parse", "TestRunInputJobStagingSwap_2020-03-29.txt").Return(&parser.DataScanner{
+		Metas: s.meta,
+		Scanner: bufio.NewScanner(strings.NewReader(`Hello     1  123
+World     1  123`)),
+	}, nil)
+	s.queryer.On("CreateTable", mock.Anything, "TestRunInputJobStagingSwap", mock.Anything).Return(nil)
+	s.queryer.On("CreateStagingTable", mock.Anything, "TestRunInputJobStagingSwap", isStaging).Return(nil)
+	s.queryer.On("InsertData", mock.Anything, isStaging, mock.Anything).Return(nil)
+	s.queryer.On("PromoteStagingTable", mock.Anything, isStaging, "TestRunInputJobStagingSwap", true).Return(nil)
+	s.mockDB.ExpectBegin()
+	s.mockDB.ExpectCommit()
+	s.mockDB.ExpectBegin()
+	s.mockDB.ExpectCommit()
+	s.mockDB.ExpectBegin()
+	s.mockDB.ExpectCommit()
+
+	err := worker.runInputJob(context.Background(), "TestRunInputJobStagingSwap_2020-03-29.txt")
+	assert.Nil(s.T(), err)
+	s.queryer.AssertNumberOfCalls(s.T(), "InsertData", 2)
+	s.queryer.AssertNotCalled(s.T(), "DropTable", mock.Anything, mock.Anything)
+	assert.Nil(s.T(), s.mockDB.ExpectationsWereMet())
+}
+
+func (s *SQLWorkerTestSuite) TestRunInputJobStagingFailDropStaging() {
+	worker := &SQLWorker{
+		DB:            s.db,
+		Queryer:       s.queryer,
+		ParserFactory: s.parserFactory,
+		BufferSize:    1,
+		Writers:       1,
+		LoadMode:      LoadMerge,
+	}
+	isStaging := mock.MatchedBy(func(name string) bool {
+		return strings.HasPrefix(name, "TestRunInputJobStagingFail_staging_")
+	})
+	dp := new(MockDataParser)
+	s.parserFactory.On("MakeParser", "TestRunInputJobStagingFail").Return(dp, nil)
+	dp.On("Meta").Return(s.meta)
+	dp.On("Parse", "TestRunInputJobStagingFail_2020-03-29.txt").Return(&parser.DataScanner{
+		Metas: s.meta,
+		Scanner: bufio.NewScanner(strings.NewReader(`Hello     1  123
+abc1123`)),
+	}, nil)
+	s.queryer.On("CreateTable", mock.Anything, "TestRunInputJobStagingFail", mock.Anything).Return(nil)
+	s.queryer.On("CreateStagingTable", mock.Anything, "TestRunInputJobStagingFail", isStaging).Return(nil)
+	s.queryer.On("InsertData", mock.Anything, isStaging, mock.Anything).Return(nil)
+	s.queryer.On("DropTable", mock.Anything, isStaging).Return(nil)
+	s.mockDB.ExpectBegin()
+	s.mockDB.ExpectCommit()
+
+	err := worker.runInputJob(context.Background(), "TestRunInputJobStagingFail_2020-03-29.txt")
+	assert.Error(s.T(), err)
+	s.queryer.AssertNotCalled(s.T(), "PromoteStagingTable", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	s.queryer.AssertCalled(s.T(), "DropTable", mock.Anything, isStaging)
+	assert.Nil(s.T(), s.mockDB.ExpectationsWereMet())
+}
+
+func (s *SQLWorkerTestSuite) TestRunInputJobMigrateFail() {
+	worker := &SQLWorker{
+		DB:               s.db,
+		Queryer:          s.queryer,
+		ParserFactory:    s.parserFactory,
+		BufferSize:       500,
+		Writers:          1,
+		AllowDestructive: true,
+	}
+	dp := new(MockDataParser)
+	s.parserFactory.On("MakeParser", "TestRunInputJobMigrateFail").Return(dp, nil)
+	dp.On("Meta").Return(s.meta)
+	s.queryer.On("CreateTable", mock.Anything, "TestRunInputJobMigrateFail", mock.Anything).Return(nil)
+	s.queryer.On("MigrateTable", mock.Anything, "TestRunInputJobMigrateFail", s.meta, true).Return(fmt.Errorf("refuse"))
+
+	err := worker.runInputJob(context.Background(), "TestRunInputJobMigrateFail_2020-03-29.txt")
+	assert.Error(s.T(), err)
+	dp.AssertNotCalled(s.T(), "Parse", mock.Anything)
+}
+
+func (s *SQLWorkerTestSuite) writeDataFile(name, content string) (string, func()) {
+	dir, _ := ioutil.TempDir("", name)
+	dataFile := filepath.Join(dir, name+"_2020-03-29.txt")
+	ioutil.WriteFile(dataFile, []byte(content), 0644)
+	return dataFile, func() { os.RemoveAll(dir) }
+}
+
+func (s *SQLWorkerTestSuite) TestRunInputJobLedgerSkip() {
+	dataFile, cleanup := s.writeDataFile("TestRunInputJobLedgerSkip", `Hello     1  123`)
+	defer cleanup()
+	ledger := new(MockLedger)
+	worker := &SQLWorker{
+		DB:            s.db,
+		Queryer:       s.queryer,
+		ParserFactory: s.parserFactory,
+		BufferSize:    500,
+		Writers:       1,
+		Ledger:        ledger,
+	}
+	dp := new(MockDataParser)
+	s.parserFactory.On("MakeParser", "TestRunInputJobLedgerSkip").Return(dp, nil)
+	dp.On("Version").Return("v1")
+	ledger.On("IsLoaded", mock.Anything, &database.LedgerEntry{
+		FileName:    "TestRunInputJobLedgerSkip_2020-03-29.txt",
+		FileSize:    16,
+		Checksum:    "01a9f6e54f63a7a0faeecb2da49896930bb896229eec9bc52e7e89f2a345b0a9",
+		SpecVersion: "v1",
+	}).Return(true, nil)
+
+	err := worker.runInputJob(context.Background(), dataFile)
+	assert.Nil(s.T(), err)
+	s.queryer.AssertNotCalled(s.T(), "CreateTable", mock.Anything, mock.Anything, mock.Anything)
+	ledger.AssertNotCalled(s.T(), "Begin", mock.Anything, mock.Anything)
+}
+
+func (s *SQLWorkerTestSuite) TestRunInputJobLedgerRecord() {
+	dataFile, cleanup := s.writeDataFile("TestRunInputJobLedgerRecord", `Hello     1  123`)
+	defer cleanup()
+	ledger := new(MockLedger)
+	worker := &SQLWorker{
+		DB:            s.db,
+		Queryer:       s.queryer,
+		ParserFactory: s.parserFactory,
+		BufferSize:    500,
+		Writers:       1,
+		Ledger:        ledger,
+		Force:         true,
+	}
+	dp := new(MockDataParser)
+	s.parserFactory.On("MakeParser", "TestRunInputJobLedgerRecord").Return(dp, nil)
+	dp.On("Version").Return("v1")
+	dp.On("Meta").Return(s.meta)
+	dp.On("Parse", dataFile).Return(&parser.DataScanner{
+		Metas:   s.meta,
+		Scanner: bufio.NewScanner(strings.NewReader(`Hello     1  123`)),
+	}, nil)
+	s.queryer.On("CreateTable", mock.Anything, "TestRunInputJobLedgerRecord", mock.Anything).Return(nil)
+	s.queryer.On("InsertData", mock.Anything, "TestRunInputJobLedgerRecord", mock.Anything).Return(nil)
+	ledger.On("Begin", mock.Anything, mock.MatchedBy(func(entry *database.LedgerEntry) bool {
+		return entry.FileName == "TestRunInputJobLedgerRecord_2020-03-29.txt" && entry.FileSize == 16
+	})).Return(int64(3), nil)
+	ledger.On("Finish", mock.Anything, int64(3), database.LedgerSuccess, 1).Return(nil)
+	s.mockDB.ExpectBegin()
+	s.mockDB.ExpectCommit()
+
+	err := worker.runInputJob(context.Background(), dataFile)
+	assert.Nil(s.T(), err)
+	ledger.AssertNotCalled(s.T(), "IsLoaded", mock.Anything, mock.Anything)
+	ledger.AssertExpectations(s.T())
+}
+
+func (s *SQLWorkerTestSuite) TestRunInputJobTableMapping() {
+	worker := &SQLWorker{
+		DB:            s.db,
+		Queryer:       s.queryer,
+		ParserFactory: s.parserFactory,
+		BufferSize:    500,
+		Writers:       1,
+		Tables:        map[string]string{"TestRunInputJobTableMapping": "mapped"},
+	}
+	dp := new(MockDataParser)
+	s.parserFactory.On("MakeParser", "TestRunInputJobTableMapping").Return(dp, nil)
+	dp.On("Meta").Return(s.meta)
+	dp.On("Parse", "TestRunInputJobTableMapping_2020-03-29.txt").Return(&parser.DataScanner{
+		Metas:   s.meta,
+		Scanner: bufio.NewScanner(strings.NewReader(`Hello     1  123`)),
+	}, nil)
+	s.queryer.On("CreateTable", mock.Anything, "mapped", mock.Anything).Return(nil)
+	s.queryer.On("InsertData", mock.Anything, "mapped", mock.Anything).Return(nil)
+	s.mockDB.ExpectBegin()
+	s.mockDB.ExpectCommit()
+
+	err := worker.runInputJob(context.Background(), "TestRunInputJobTableMapping_2020-03-29.txt")
+	assert.Nil(s.T(), err)
+}
+
+func (s *SQLWorkerTestSuite) TestNewSQLWorker() {
+	job := &config.Job{
+		Name:      "sample",
+		SpecDir:   "specs",
+		BatchSize: 10,
+		Insert:    "insert",
+		LoadMode:  LoadSwap,
+		Rejects:   &config.Rejects{MaxCount: 3},
+		Tables:    map[string]string{"sample": "sample_daily"},
+		Patterns: []*config.Pattern{
+			&config.Pattern{
+				Regex:   `^(?P<model>[a-z]+)_(?P<load_date>\d{8})`,
+				Columns: map[string]*config.Column{"load_date": &config.Column{Type: "date"}},
+			},
+		},
+	}
+	worker, err := NewSQLWorker(job, s.db)
+	assert.Nil(s.T(), err)
+	assert.IsType(s.T(), &database.QueryerImpl{}, worker.Queryer)
+	assert.Equal(s.T(), 10, worker.BufferSize)
+	assert.Equal(s.T(), LoadSwap, worker.LoadMode)
+	assert.Equal(s.T(), &RejectPolicy{MaxCount: 3}, worker.Rejects)
+	assert.NotNil(s.T(), worker.Ledger)
+	assert.Equal(s.T(), "sample_daily", worker.tableName("sample"))
+	assert.Equal(s.T(), "other", worker.tableName("other"))
+	assert.Equal(s.T(), "DATE", worker.Patterns[0].Columns["load_date"].DataType)
+
+	job.Patterns[0].Regex = `^(?P<load_date>\d{8})`
+	_, err = NewSQLWorker(job, s.db)
+	assert.Error(s.T(), err)
+	job.Patterns = nil
+
+	job.ParseWorkers = -1
+	_, err = NewSQLWorker(job, s.db)
+	assert.Error(s.T(), err)
+	job.ParseWorkers = 2
+	_, err = NewSQLWorker(job, s.db)
+	assert.Nil(s.T(), err)
+	// in append mode a reject limit or the first bad row would stop the
+	// file with the rows of every range committed
+	job.LoadMode = LoadAppend
+	_, err = NewSQLWorker(job, s.db)
+	assert.Error(s.T(), err)
+	job.Rejects = nil
+	_, err = NewSQLWorker(job, s.db)
+	assert.Error(s.T(), err)
+	job.Rejects = &config.Rejects{}
+	_, err = NewSQLWorker(job, s.db)
+	assert.Nil(s.T(), err)
+	job.ParseWorkers = 0
+
+	// a percent of rejects is only known at the end of the file, when the
+	// rows of append mode are already committed
+	job.Rejects = &config.Rejects{MaxPercent: 1}
+	_, err = NewSQLWorker(job, s.db)
+	assert.Error(s.T(), err)
+	job.LoadMode = LoadMerge
+	_, err = NewSQLWorker(job, s.db)
+	assert.Nil(s.T(), err)
+
+	job.LoadMode = "sideways"
+	_, err = NewSQLWorker(job, s.db)
+	assert.Error(s.T(), err)
+}
+
+func (s *SQLWorkerTestSuite) TestRunInputJobPattern() {
+	pattern, err := NewFilePattern(`^(?P<model>daily_sales)_(?P<load_date>\d{8})\.txt$`, map[string]*parser.SQLMeta{
+		"load_date": &parser.SQLMeta{Name: "load_date", DataType: "DATE"},
+	})
+	assert.Nil(s.T(), err)
+	worker := &SQLWorker{
+		DB:            s.db,
+		Queryer:       s.queryer,
+		ParserFactory: s.parserFactory,
+		BufferSize:    500,
+		Writers:       1,
+		Patterns:      []*FilePattern{pattern},
+	}
+	dp := new(MockDataParser)
+	s.parserFactory.On("MakeParser", "daily_sales").Return(dp, nil)
+	dp.On("Meta").Return(s.meta)
+	dp.On("Parse", "daily_sales_20200329.txt").Return(&parser.DataScanner{
+		Metas:   s.meta,
+		Scanner: bufio.NewScanner(strings.NewReader(`Hello     1  123`)),
+	}, nil)
+	s.queryer.On("CreateTable", mock.Anything, "daily_sales", append(s.meta, pattern.Columns["load_date"])).Return(nil)
+	s.queryer.On("InsertData", mock.Anything, "daily_sales", []*parser.Row{
+		&parser.Row{
+			Metas:  append(s.meta, pattern.Columns["load_date"]),
+			Values: []interface{}{"Hello", true, 123, time.Date(2020, 3, 29, 0, 0, 0, 0, time.UTC)},
+		},
+	}).Return(nil)
+	s.mockDB.ExpectBegin()
+	s.mockDB.ExpectCommit()
+
+	err = worker.runInputJob(context.Background(), "daily_sales_20200329.txt")
+	assert.Nil(s.T(), err)
+
+	err = worker.runInputJob(context.Background(), "weekly_sales_20200329.txt")
+	assert.Error(s.T(), err)
+}
+
+func (s *SQLWorkerTestSuite) TestRunInputJobLineage() {
+	worker := &SQLWorker{
+		DB:            s.db,
+		Queryer:       s.queryer,
+		ParserFactory: s.parserFactory,
+		BufferSize:    500,
+		Writers:       1,
+		Lineage:       true,
+	}
+	dp := new(MockDataParser)
+	s.parserFactory.On("MakeParser", "TestRunInputJobLineage").Return(dp, nil)
+	dp.On("Meta").Return(s.meta)
+	dp.On("Parse", "data/TestRunInputJobLineage_2020-03-29.txt").Return(&parser.DataScanner{
+		Metas: s.meta,
+		Scanner: bufio.NewScanner(strings.NewReader(`Hello     1  123
+World     0  321`)),
+	}, nil)
+	s.queryer.On("CreateTable", mock.Anything, "TestRunInputJobLineage", append(s.meta, lineageMetas...)).Return(nil)
+	var rows []*parser.Row
+	s.queryer.On("InsertData", mock.Anything, "TestRunInputJobLineage", mock.Anything).Run(func(args mock.Arguments) {
+		rows = args.Get(2).([]*parser.Row)
+	}).Return(nil)
+	s.mockDB.ExpectBegin()
+	s.mockDB.ExpectCommit()
+
+	err := worker.runInputJob(context.Background(), "data/TestRunInputJobLineage_2020-03-29.txt")
+	assert.Nil(s.T(), err)
+	assert.Len(s.T(), rows, 2)
+	for i, row := range rows {
+		assert.Equal(s.T(), "TestRunInputJobLineage_2020-03-29.txt", row.Map()[LineageFile])
+		assert.Equal(s.T(), int64(i+1), row.Map()[LineageLine])
+		assert.IsType(s.T(), time.Time{}, row.Map()[LineageLoadedAt])
+	}
+}
+
+func (s *SQLWorkerTestSuite) TestRunInputJobParseWorkers() {
+	dir, _ := ioutil.TempDir("", "TestRunInputJobParseWorkers")
+	defer os.RemoveAll(dir)
+	dataFile := filepath.Join(dir, "TestRunInputJobParseWorkers_2020-03-29.txt")
+	var data strings.Builder
+	for i := 1; i <= 20; i++ {
+		if i == 7 {
+			data.WriteString("abc1123\n")
+			continue
+		}
+		fmt.Fprintf(&data, "%-10s1%5d\n", "Hello", i)
+	}
+	ioutil.WriteFile(dataFile, []byte(data.String()), 0644)
+
+	worker := &SQLWorker{
+		DB:            s.db,
+		Queryer:       s.queryer,
+		ParserFactory: s.parserFactory,
+		BufferSize:    4,
+		Writers:       1,
+		Rejects:       &RejectPolicy{},
+		Lineage:       true,
+		ParseWorkers:  3,
+		minChunkSize:  1,
+	}
+	dp := new(MockDataParser)
+	s.parserFactory.On("MakeParser", "TestRunInputJobParseWorkers").Return(dp, nil)
+	dp.On("Meta").Return(s.meta)
+	dp.On("Parse", dataFile).Return(parser.NewDataParser(s.meta).Parse(dataFile))
+	s.queryer.On("CreateTable", mock.Anything, "TestRunInputJobParseWorkers", mock.Anything).Return(nil)
+	var rows []*parser.Row
+	s.queryer.On("InsertData", mock.Anything, "TestRunInputJobParseWorkers", mock.Anything).Run(func(args mock.Arguments) {
+		rows = append(rows, args.Get(2).([]*parser.Row)...)
+	}).Return(nil)
+	// the batches commit in any order
+	s.mockDB.MatchExpectationsInOrder(false)
+	for i := 0; i < 5; i++ {
+		s.mockDB.ExpectBegin()
+		s.mockDB.ExpectCommit()
+	}
+
+	err := worker.runInputJob(context.Background(), dataFile)
+	assert.Nil(s.T(), err)
+	assert.Len(s.T(), rows, 19)
+	for _, row := range rows {
+		// every row keeps the line it was read from
+		count, _ := row.Get("count")
+		line, _ := row.Get(LineageLine)
+		assert.Equal(s.T(), int64(count.(int)), line)
+	}
+	content, err := ioutil.ReadFile(dataFile + ".rejects")
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), "7\tnot enough length of data\tabc1123\n", string(content))
+}
+
+func (s *SQLWorkerTestSuite) TestRunInputJobWriters() {
+	worker := &SQLWorker{
+		DB:            s.db,
+		Queryer:       s.queryer,
+		ParserFactory: s.parserFactory,
+		BufferSize:    1,
+		Writers:       2,
+	}
+	dp := new(MockDataParser)
+	s.parserFactory.On("MakeParser", "TestRunInputJobWriters").Return(dp, nil)
+	dp.On("Meta").Return(s.meta)
+	dp.On("Parse", "TestRunInputJobWriters_2020-03-29.txt").Return(&parser.DataScanner{
+		Metas: s.meta,
+		Scanner: bufio.NewScanner(strings.NewReader(`Hello     1    1
+Hello     1    2
+Hello     1    3
+Hello     1    4`)),
+	}, nil)
+	s.queryer.On("CreateTable", mock.Anything, "TestRunInputJobWriters", mock.Anything).Return(nil)
+	var lock sync.Mutex
+	active, most := 0, 0
+	both := make(chan bool)
+	s.queryer.On("InsertData", mock.Anything, "TestRunInputJobWriters", mock.Anything).Run(func(args mock.Arguments) {
+		lock.Lock()
+		active++
+		if active > most {
+			most = active
+		}
+		if active == 2 && most == 2 && both != nil {
+			close(both)
+			both = nil
+		}
+		wait := both
+		lock.Unlock()
+		// the first insert waits for the second one to start
+		if wait != nil {
+			select {
+			case <-wait:
+			case <-time.After(time.Second):
+			}
+		}
+		lock.Lock()
+		active--
+		lock.Unlock()
+	}).Return(nil)
+	s.mockDB.MatchExpectationsInOrder(false)
+	for i := 0; i < 4; i++ {
+		s.mockDB.ExpectBegin()
+		s.mockDB.ExpectCommit()
+	}
+
+	err := worker.runInputJob(context.Background(), "TestRunInputJobWriters_2020-03-29.txt")
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), 2, most)
+	s.queryer.AssertNumberOfCalls(s.T(), "InsertData", 4)
+}
+
+func (s *SQLWorkerTestSuite) TestRunInputJobWritersShared() {
+	worker := &SQLWorker{
+		DB:            s.db,
+		Queryer:       s.queryer,
+		ParserFactory: s.parserFactory,
+		BufferSize:    1,
+		Writers:       2,
+	}
+	dp := new(MockDataParser)
+	s.parserFactory.On("MakeParser", "TestRunInputJobWritersShared").Return(dp, nil)
+	dp.On("Meta").Return(s.meta)
+	files := []string{"TestRunInputJobWritersShared_2020-03-29.txt", "TestRunInputJobWritersShared_2020-03-30.txt"}
+	for _, file := range files {
+		dp.On("Parse", file).Return(&parser.DataScanner{
+			Metas: s.meta,
+			Scanner: bufio.NewScanner(strings.NewReader(`Hello     1    1
+Hello     1    2
+Hello     1    3`)),
+		}, nil)
+	}
+	s.queryer.On("CreateTable", mock.Anything, "TestRunInputJobWritersShared", mock.Anything).Return(nil)
+	var lock sync.Mutex
+	active, most := 0, 0
+	s.queryer.On("InsertData", mock.Anything, "TestRunInputJobWritersShared", mock.Anything).Run(func(args mock.Arguments) {
+		lock.Lock()
+		active++
+		if active > most {
+			most = active
+		}
+		lock.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		lock.Lock()
+		active--
+		lock.Unlock()
+	}).Return(nil)
+	s.mockDB.MatchExpectationsInOrder(false)
+	for i := 0; i < 6; i++ {
+		s.mockDB.ExpectBegin()
+		s.mockDB.ExpectCommit()
+	}
+
+	var wg sync.WaitGroup
+	for _, file := range files {
+		wg.Add(1)
+		go func(file string) {
+			defer wg.Done()
+			assert.Nil(s.T(), worker.runInputJob(context.Background(), file))
+		}(file)
+	}
+	wg.Wait()
+	// both files insert through the same two writers
+	assert.True(s.T(), most <= 2, "%d inserts at the same time", most)
+	s.queryer.AssertNumberOfCalls(s.T(), "InsertData", 6)
+}
+
+func (s *SQLWorkerTestSuite) TestRunInputJobWriterFail() {
+	worker := &SQLWorker{
+		DB:            s.db,
+		Queryer:       s.queryer,
+		ParserFactory: s.parserFactory,
+		BufferSize:    1,
+		Writers:       1,
+	}
+	dp := new(MockDataParser)
+	s.parserFactory.On("MakeParser", "TestRunInputJobWriterFail").Return(dp, nil)
+	dp.On("Meta").Return(s.meta)
+	dp.On("Parse", "TestRunInputJobWriterFail_2020-03-29.txt").Return(&parser.DataScanner{
+		Metas: s.meta,
+		Scanner: bufio.NewScanner(strings.NewReader(`Hello     1    1
+Hello     1    2
+Hello     1    3`)),
+	}, nil)
+	s.queryer.On("CreateTable", mock.Anything, "TestRunInputJobWriterFail", mock.Anything).Return(nil)
+	s.queryer.On("InsertData", mock.Anything, "TestRunInputJobWriterFail", mock.Anything).Return(fmt.Errorf("refused"))
+	s.mockDB.ExpectBegin()
+	s.mockDB.ExpectRollback()
+
+	err := worker.runInputJob(context.Background(), "TestRunInputJobWriterFail_2020-03-29.txt")
+	assert.EqualError(s.T(), err, "File TestRunInputJobWriterFail_2020-03-29.txt, inserted: 0 failed: Inserted Error: line: 1 err: Fail to insert data, refused")
+	// the writers stop at the first failed batch
+	s.queryer.AssertNumberOfCalls(s.T(), "InsertData", 1)
+	assert.Nil(s.T(), s.mockDB.ExpectationsWereMet())
+}
+
+func (s *SQLWorkerTestSuite) TestRunInputJobLineageConflict() {
+	worker := &SQLWorker{
+		DB:            s.db,
+		Queryer:       s.queryer,
+		ParserFactory: s.parserFactory,
+		BufferSize:    500,
+		Writers:       1,
+		Lineage:       true,
+	}
+	dp := new(MockDataParser)
+	s.parserFactory.On("MakeParser", "TestRunInputJobLineageConflict").Return(dp, nil)
+	dp.On("Meta").Return([]*parser.SQLMeta{&parser.SQLMeta{Name: LineageLine, Size: 5, DataType: "INTEGER"}})
+
+	err := worker.runInputJob(context.Background(), "TestRunInputJobLineageConflict_2020-03-29.txt")
+	assert.Error(s.T(), err)
+	s.queryer.AssertNotCalled(s.T(), "CreateTable")
+}
+
+func (s *SQLWorkerTestSuite) TestRunInputJobLayouts() {
+	worker := &SQLWorker{
+		DB:            s.db,
+		Queryer:       s.queryer,
+		ParserFactory: s.parserFactory,
+		BufferSize:    500,
+		Writers:       1,
+		LoadMode:      LoadMerge,
+		Tables:        map[string]string{"bank_detail": "bank_rows"},
+	}
+	layouts := []*parser.Layout{
+		&parser.Layout{Code: "H", Model: "bank_header", Metas: []*parser.SQLMeta{
+			&parser.SQLMeta{Name: "type", Size: 1, DataType: "TEXT"},
+			&parser.SQLMeta{Name: "day", Size: 8, DataType: "TEXT"},
+		}},
+		&parser.Layout{Code: "D", Model: "bank_detail", Metas: append([]*parser.SQLMeta{
+			&parser.SQLMeta{Name: "type", Size: 1, DataType: "TEXT"},
+		}, s.meta...)},
+		&parser.Layout{Code: "T", Model: "bank_trailer", Metas: []*parser.SQLMeta{
+			&parser.SQLMeta{Name: "type", Size: 1, DataType: "TEXT"},
+			&parser.SQLMeta{Name: "count", Size: 6, DataType: "INTEGER"},
+		}},
+	}
+	scanner := &parser.DataScanner{
+		Layouts: layouts,
+		Scanner: bufio.NewScanner(strings.NewReader(`H20200329
+DHello     1  123
+DWorld     0  321
+T000002`)),
+	}
+	scanner.SetOptions(parser.SpecOptions{DiscriminatorStart: 1, DiscriminatorWidth: 1, Header: "H", Trailer: "T", TrailerCount: "count"})
+	dp := &MockDataParser{layouts: layouts}
+	s.parserFactory.On("MakeParser", "bank").Return(dp, nil)
+	dp.On("Meta").Return([]*parser.SQLMeta(nil))
+	dp.On("Parse", "bank_20200329.txt").Return(scanner, nil)
+	for _, table := range []string{"bank_header", "bank_rows", "bank_trailer"} {
+		table := table
+		isStaging := mock.MatchedBy(func(name string) bool {
+			return strings.HasPrefix(name, table+"_staging_")
+		})
+		s.queryer.On("CreateTable", mock.Anything, table, mock.Anything).Return(nil)
+		s.queryer.On("CreateStagingTable", mock.Anything, table, isStaging).Return(nil)
+		s.queryer.On("PromoteStagingTable", mock.Anything, isStaging, table, false).Return(nil)
+	}
+	var lock sync.Mutex
+	var inserted = make(map[string]int)
+	s.queryer.On("InsertData", mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		table := strings.Split(args.String(1), "_staging_")[0]
+		lock.Lock()
+		inserted[table] += len(args.Get(2).([]*parser.Row))
+		lock.Unlock()
+	}).Return(nil)
+	for i := 0; i < 4; i++ {
+		s.mockDB.ExpectBegin()
+		s.mockDB.ExpectCommit()
+	}
+
+	err := worker.runInputJob(context.Background(), "bank_20200329.txt")
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), map[string]int{"bank_header": 1, "bank_rows": 2, "bank_trailer": 1}, inserted)
+	s.queryer.AssertNumberOfCalls(s.T(), "PromoteStagingTable", 3)
+	assert.Nil(s.T(), s.mockDB.ExpectationsWereMet())
+}
+
 func TestSQLWorker(t *testing.T) {
 	suite.Run(t, new(SQLWorkerTestSuite))
 }
@@ -0,0 +1,81 @@
+package worker
+
+import (
+	"data_play/pkg/parser"
+	"fmt"
+)
+
+// target is a table a file loads into, through insert when it is staged
+type target struct {
+	table     string
+	insert    string
+	metas     []*parser.SQLMeta
+	buffer    []*parser.Row
+	firstLine int
+}
+
+// targetSet are the tables of a file by record type, a spec without layouts
+// has the single record type ""
+type targetSet struct {
+	list   []*target
+	byCode map[string]*target
+}
+
+// row binds a row of the file to the metas of t, followed by the values of
+// the partition
+func (t *target) row(row *parser.Row, partition []interface{}) *parser.Row {
+	if len(partition) == 0 {
+		return row
+	}
+	values := make([]interface{}, 0, len(row.Values)+len(partition))
+	values = append(append(values, row.Values...), partition...)
+	return &parser.Row{Metas: t.metas, Values: values}
+}
+
+func (ts *targetSet) route(layout *parser.Layout) *target {
+	if layout == nil {
+		return ts.byCode[""]
+	}
+	return ts.byCode[layout.Code]
+}
+
+// targets resolves the table of every record type, the layouts of the same
+// model share their table
+func (f *SQLWorker) targets(p parser.DataParser, partition *Partition, modelName string) (*targetSet, error) {
+	targets := &targetSet{byCode: make(map[string]*target)}
+	if len(p.Layouts()) == 0 {
+		t := &target{table: f.tableName(modelName), metas: withPartition(p.Meta(), partition)}
+		targets.list = append(targets.list, t)
+		targets.byCode[""] = t
+		return targets, nil
+	}
+	models := make(map[string]string)
+	byModel := make(map[string]*target)
+	for _, layout := range p.Layouts() {
+		t, ok := byModel[layout.Model]
+		if !ok {
+			t = &target{table: f.tableName(layout.Model), metas: withPartition(layout.Metas, partition)}
+			if other, ok := models[t.table]; ok {
+				return nil, fmt.Errorf("Layouts %s and %s of %s load into the same table %s", other, layout.Model, modelName, t.table)
+			}
+			models[t.table] = layout.Model
+			byModel[layout.Model] = t
+			targets.list = append(targets.list, t)
+		}
+		targets.byCode[layout.Code] = t
+	}
+	return targets, nil
+}
+
+func withPartition(metas []*parser.SQLMeta, partition *Partition) []*parser.SQLMeta {
+	return append(append([]*parser.SQLMeta{}, metas...), partition.Metas...)
+}
+
+// specMetas are the columns of every record type of a spec
+func specMetas(p parser.DataParser) []*parser.SQLMeta {
+	metas := p.Meta()
+	for _, layout := range p.Layouts() {
+		metas = append(append([]*parser.SQLMeta{}, metas...), layout.Metas...)
+	}
+	return metas
+}
@@ -0,0 +1,109 @@
+package worker
+
+import (
+	"context"
+	"data_play/pkg/database"
+	"data_play/pkg/parser"
+	"fmt"
+	"sync"
+)
+
+// batch is a full buffer of a target on its way to a writer
+type batch struct {
+	table     string
+	rows      []*parser.Row
+	firstLine int
+}
+
+// writerPool inserts the batches of a file with writers of their own
+// transaction, at most one batch per writer waits so a slow database holds
+// back the readers instead of piling up rows. The writers of every file take
+// a slot of their SQLWorker for each insert, so the files loaded at the same
+// time share as many inserts as the connection pool has connections.
+type writerPool struct {
+	batches  chan batch
+	ctx      context.Context
+	stop     func()
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	inserted int
+	err      error
+}
+
+// writers is Writers, or the max open connections of DB when it is unset
+func (f *SQLWorker) writers() int {
+	if f.Writers > 0 {
+		return f.Writers
+	}
+	if conns := f.DB.Stats().MaxOpenConnections; conns > 0 {
+		return conns
+	}
+	return database.DefaultMaxOpenConns
+}
+
+// insertSlots are the inserts running at the same time across the files of
+// f, made on first use
+func (f *SQLWorker) insertSlots() chan struct{} {
+	f.slotsOnce.Do(func() {
+		f.slots = make(chan struct{}, f.writers())
+	})
+	return f.slots
+}
+
+// startWriters starts n writers, the first failed insert stops them all
+func (f *SQLWorker) startWriters(cancelContext context.Context, n int) *writerPool {
+	slots := f.insertSlots()
+	ctx, stop := context.WithCancel(cancelContext)
+	w := &writerPool{batches: make(chan batch, n), ctx: ctx, stop: stop}
+	for i := 0; i < n; i++ {
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			for b := range w.batches {
+				select {
+				case <-ctx.Done():
+					continue
+				case slots <- struct{}{}:
+				}
+				err := f.safeInsertData(ctx, b.table, b.rows)
+				<-slots
+				w.done(b, err)
+			}
+		}()
+	}
+	return w
+}
+
+func (w *writerPool) done(b batch, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err == nil {
+		w.inserted += len(b.rows)
+		return
+	}
+	if w.err == nil {
+		w.err = fmt.Errorf("Inserted Error: line: %d err: %v", b.firstLine, err)
+		w.stop()
+	}
+}
+
+// write hands the buffer of t to a writer, waiting for one to be free. It
+// is false once the writers stopped.
+func (w *writerPool) write(t *target) bool {
+	select {
+	case <-w.ctx.Done():
+		return false
+	case w.batches <- batch{table: t.insert, rows: t.buffer, firstLine: t.firstLine}:
+		t.buffer = nil
+		return true
+	}
+}
+
+// wait lets the writers insert the batches handed over and returns how
+// many rows they inserted and the first error
+func (w *writerPool) wait() (int, error) {
+	close(w.batches)
+	w.wg.Wait()
+	w.stop()
+	return w.inserted, w.err
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"data_play/pkg/database"
+	"data_play/pkg/parser"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// printExecer prints the statements instead of running them
+type printExecer struct{}
+
+func (printExecer) Exec(query string, args ...interface{}) (sql.Result, error) {
+	fmt.Printf("%s;\n", query)
+	return nil, nil
+}
+
+// runSchema prints the tables of the specs named in args, or of every spec,
+// and with -apply creates or migrates them in the database
+func runSchema(args []string) int {
+	o := &options{}
+	var apply bool
+	fs := flag.NewFlagSet("schema", flag.ExitOnError)
+	o.connectionFlags(fs)
+	fs.StringVar(&o.specDir, "specs", "specs", "directory of the spec csv")
+	fs.BoolVar(&apply, "apply", false, "create or migrate the tables instead of printing them")
+	fs.BoolVar(&o.allowDestructive, "allow-destructive", false, "let -apply narrow, retype or drop columns")
+	if err := parseFlags(fs, args); err != nil {
+		fmt.Println(err)
+		return 2
+	}
+
+	models := fs.Args()
+	listed := len(models) == 0
+	if listed {
+		files, err := ioutil.ReadDir(o.specDir)
+		if err != nil {
+			fmt.Printf("Fail to read spec dir %v\n", err)
+			return 1
+		}
+		for _, file := range files {
+			if filepath.Ext(file.Name()) == ".csv" {
+				models = append(models, strings.TrimSuffix(file.Name(), ".csv"))
+			}
+		}
+	}
+
+	var db *database.PostgresDB
+	var err error
+	if apply {
+		db, err = connect(o.database())
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+	}
+	queryer := &database.QueryerImpl{}
+	factory := parser.NewDataParserFactory(specPath(o.specDir))
+	code := 0
+	for _, model := range models {
+		p, err := factory.MakeParser(model)
+		if err != nil {
+			fmt.Printf("Fail to read spec %s %v\n", model, err)
+			code = 1
+			continue
+		}
+		tables := map[string][]*parser.SQLMeta{model: p.Meta()}
+		names := []string{model}
+		if len(p.Layouts()) > 0 {
+			if listed {
+				// the spec of every layout is listed on its own
+				continue
+			}
+			tables, names = map[string][]*parser.SQLMeta{}, nil
+			for _, layout := range p.Layouts() {
+				if _, ok := tables[layout.Model]; !ok {
+					names = append(names, layout.Model)
+				}
+				tables[layout.Model] = layout.Metas
+			}
+		}
+		for _, table := range names {
+			if !apply {
+				if err = queryer.CreateTable(printExecer{}, table, tables[table]); err != nil {
+					fmt.Printf("Fail to print %s %v\n", table, err)
+					code = 1
+				}
+				continue
+			}
+			err = queryer.CreateTable(db.Conn(), table, tables[table])
+			if err == nil {
+				err = queryer.MigrateTable(db.Conn(), table, tables[table], o.allowDestructive)
+			}
+			if err != nil {
+				fmt.Printf("Fail to apply %s %v\n", table, err)
+				code = 1
+				continue
+			}
+			fmt.Printf("[Done] Table %s\n", table)
+		}
+	}
+	return code
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"data_play/pkg/config"
+	"data_play/pkg/parser"
+	"data_play/pkg/worker"
+	"flag"
+	"fmt"
+)
+
+// runValidate parses every data file against its spec and reports the bad
+// lines, it never touches the database
+func runValidate(args []string) int {
+	o := &options{}
+	var maxErrors int
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	o.inputFlags(fs)
+	o.configFlags(fs)
+	fs.IntVar(&o.workers, "workers", 1, "files validated at the same time")
+	fs.IntVar(&maxErrors, "max-errors", 10, "bad lines reported per file")
+	if err := parseFlags(fs, args); err != nil {
+		fmt.Println(err)
+		return 2
+	}
+
+	_, jobs, err := o.jobs()
+	if err != nil {
+		fmt.Println(err)
+		return 2
+	}
+	cancelContext, cancel := interruptContext()
+	defer cancel()
+	code := 0
+	for _, job := range jobs {
+		inputs, err := listInputs(job.Input)
+		if err != nil {
+			fmt.Printf("Job %s: %v\n", job.Name, err)
+			code = 1
+			continue
+		}
+		patterns, err := worker.JobPatterns(job)
+		if err != nil {
+			fmt.Printf("Job %s: %v\n", job.Name, err)
+			code = 1
+			continue
+		}
+		factory := parser.NewDataParserFactory(specPath(job.SpecDir))
+		failed := runJobs(cancelContext, o.workers, inputs, func(cancelContext context.Context, dataFile string) error {
+			return validateFile(cancelContext, factory, patterns, job, dataFile, maxErrors)
+		})
+		if cancelContext.Err() != nil || failed > 0 {
+			fmt.Printf("Job %s: %d of %d files invalid\n", job.Name, failed, len(inputs))
+			code = 1
+		}
+	}
+	return code
+}
+
+func validateFile(cancelContext context.Context, factory parser.DataParserFactory, patterns []*worker.FilePattern, job *config.Job, dataFile string, maxErrors int) error {
+	model, _, err := worker.MatchFile(patterns, dataFile)
+	if err != nil {
+		return fmt.Errorf("[Invalid] File %s: %v", dataFile, err)
+	}
+	p, err := factory.MakeParser(model)
+	if err != nil {
+		return fmt.Errorf("[Invalid] File %s: %v", dataFile, err)
+	}
+	scanner, err := p.Parse(dataFile)
+	if err != nil {
+		return fmt.Errorf("[Invalid] File %s: %v", dataFile, err)
+	}
+	defer scanner.Close()
+	if job.Encoding != "" {
+		if err = scanner.SetEncoding(job.Encoding); err != nil {
+			return fmt.Errorf("[Invalid] File %s: %v", dataFile, err)
+		}
+	}
+	if job.MaxRecordLength > 0 {
+		if err = scanner.SetMaxRecordLength(job.MaxRecordLength); err != nil {
+			return fmt.Errorf("[Invalid] File %s: %v", dataFile, err)
+		}
+	}
+
+	var rows, bad int
+	for cancelContext.Err() == nil {
+		_, haveData, err := scanner.ReadRow()
+		if !haveData {
+			if err != nil {
+				return fmt.Errorf("[Invalid] File %s: %v", dataFile, err)
+			}
+			break
+		}
+		if err != nil {
+			bad++
+			if bad <= maxErrors {
+				fmt.Printf("[Invalid] File %s line %d: %v\n", dataFile, scanner.Line(), err)
+			}
+			continue
+		}
+		rows++
+	}
+	if cancelContext.Err() != nil {
+		return fmt.Errorf("[Canceled] File %s", dataFile)
+	}
+	if bad > 0 {
+		return fmt.Errorf("[Invalid] File %s rows: %d bad: %d", dataFile, rows, bad)
+	}
+	fmt.Printf("[Valid] File %s rows: %d\n", dataFile, rows)
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"data_play/pkg/database"
+	"data_play/pkg/parser"
+	"data_play/pkg/watcher"
+	"data_play/pkg/worker"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// runWatch keeps loading the files dropped in the inputs of the jobs until
+// interrupted, moving each one to processed/ or failed/ once loaded
+func runWatch(args []string) int {
+	o := &options{}
+	var interval time.Duration
+	var marker, processedDir, failedDir string
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	o.connectionFlags(fs)
+	o.inputFlags(fs)
+	o.loadFlags(fs)
+	o.configFlags(fs)
+	fs.DurationVar(&interval, "interval", 5*time.Second, "time between two polls of the inputs")
+	fs.StringVar(&marker, "marker", "", "suffix of the file marking a data file complete, like .done, default is a stable size")
+	fs.StringVar(&processedDir, "processed", watcher.DefaultProcessedDir, "dir of the loaded files, relative to the file")
+	fs.StringVar(&failedDir, "failed", watcher.DefaultFailedDir, "dir of the failed files, relative to the file")
+	if err := parseFlags(fs, args); err != nil {
+		fmt.Println(err)
+		return 2
+	}
+	if interval <= 0 {
+		fmt.Println("-interval must be positive")
+		return 2
+	}
+
+	cfg, jobs, err := o.jobs()
+	if err != nil {
+		fmt.Println(err)
+		return 2
+	}
+	cancelContext, cancel := interruptContext()
+	defer cancel()
+	dbs := make(map[string]*database.PostgresDB)
+	var inputs []string
+	for _, job := range jobs {
+		inputs = append(inputs, job.Input)
+	}
+	// an archive with members of several jobs moves once they all loaded it
+	archives := watcher.NewArchives(inputs...)
+	var watchers []*watcher.Watcher
+	var workers []*worker.SQLWorker
+	for _, job := range jobs {
+		db, ok := dbs[job.Database]
+		if !ok {
+			db, err = connect(cfg.Databases[job.Database])
+			if err != nil {
+				fmt.Println(err)
+				return 1
+			}
+			dbs[job.Database] = db
+		}
+		sqlWorker, err := newWorker(job, db)
+		if err != nil {
+			fmt.Printf("Job %s: %v\n", job.Name, err)
+			return 1
+		}
+		w := watcher.NewWatcher(job.Input, marker)
+		w.ProcessedDir = processedDir
+		w.FailedDir = failedDir
+		w.Archives = archives
+		watchers = append(watchers, w)
+		workers = append(workers, sqlWorker)
+	}
+
+	var wg sync.WaitGroup
+	for i, job := range jobs {
+		fmt.Printf("Job %s watching %s\n", job.Name, job.Input)
+		wg.Add(1)
+		go func(w *watcher.Watcher, sqlWorker *worker.SQLWorker, workers int, input string) {
+			defer wg.Done()
+			w.Run(cancelContext, interval, workers, func(cancelContext context.Context, file string) error {
+				return runArchive(cancelContext, file, input, sqlWorker.Run)
+			})
+		}(watchers[i], workers[i], job.Workers, job.Input)
+	}
+	wg.Wait()
+	return 0
+}
+
+// runArchive calls run on every member of a zip archive matching the input
+// glob, or on file itself when it is not an archive. The archive fails when
+// one of its members does.
+func runArchive(cancelContext context.Context, file, input string, run func(context.Context, string) error) error {
+	if !parser.IsArchive(file) {
+		return run(cancelContext, file)
+	}
+	members, err := parser.ArchiveMembers(file, filepath.Base(input))
+	if err != nil {
+		return err
+	}
+	var failed int
+	for _, member := range members {
+		if cancelContext.Err() != nil {
+			return cancelContext.Err()
+		}
+		if err = run(cancelContext, member); err != nil {
+			fmt.Println(err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("Archive %s, %d of %d members failed", file, failed, len(members))
+	}
+	return nil
+}